@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+
+	shorty "github.com/otaviof/shorty/pkg/shorty"
+	"github.com/spf13/cobra"
+)
+
+var backupCmd = &cobra.Command{
+	Use:   "backup",
+	RunE:  runBackup,
+	Args:  cobra.NoArgs,
+	Short: "Online backup of configured database.",
+	Long: `
+Backup configured database using SQLite online backup API, safe to run while Shorty is serving
+requests. For instance:
+
+	shorty backup --database-file /var/lib/shorty/shorty.sqlite --to /var/backups/shorty.sqlite`,
+}
+
+var restoreCmd = &cobra.Command{
+	Use:   "restore",
+	RunE:  runRestore,
+	Args:  cobra.NoArgs,
+	Short: "Restore configured database from a backup file.",
+	Long: `
+Restore configured database file from a backup, after checking backup integrity and schema version.
+The current database file is kept with ".before-restore" suffix. Shorty must be stopped during
+restore. For instance:
+
+	shorty restore --database-file /var/lib/shorty/shorty.sqlite --from /var/backups/shorty.sqlite`,
+}
+
+// runBackup writes a online backup on informed file.
+func runBackup(cmd *cobra.Command, args []string) error {
+	to, _ := cmd.Flags().GetString("to")
+
+	p, err := newPersistence()
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	return p.Backup(context.Background(), to)
+}
+
+// runRestore swaps configured database file by informed backup.
+func runRestore(cmd *cobra.Command, args []string) error {
+	from, _ := cmd.Flags().GetString("from")
+	config, err := toolConfig()
+	if err != nil {
+		return err
+	}
+	return shorty.Restore(config.DatabaseFile, from)
+}
+
+// init setup sub-commands command-line arguments.
+func init() {
+	backupCmd.Flags().String("to", "", "backup file path")
+	_ = backupCmd.MarkFlagRequired("to")
+
+	restoreCmd.Flags().String("from", "", "backup file path")
+	_ = restoreCmd.MarkFlagRequired("from")
+
+	rootCmd.AddCommand(backupCmd, restoreCmd)
+}
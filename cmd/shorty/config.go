@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/mitchellh/mapstructure"
+	shorty "github.com/otaviof/shorty/pkg/shorty"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+)
+
+// settings maps command-line flags to configuration file keys, organized in sections.
+var settings = map[string]string{
+	"address":                 "server.address",
+	"socket-mode":             "server.socket-mode",
+	"tls-cert":                "server.tls-cert",
+	"tls-key":                 "server.tls-key",
+	"tls-redirect-address":    "server.tls-redirect-address",
+	"public-url":              "server.public-url",
+	"admin-address":           "server.admin-address",
+	"idle-timeout":            "server.idle-timeout",
+	"read-timeout":            "server.read-timeout",
+	"write-timeout":           "server.write-timeout",
+	"shutdown-timeout":        "server.shutdown-timeout",
+	"shutdown-delay":          "server.shutdown-delay",
+	"database-file":           "storage.database-file",
+	"sqlite-flags":            "storage.sqlite-flags",
+	"case-insensitive":        "storage.case-insensitive",
+	"trash-retention":         "storage.trash-retention",
+	"admin-token":             "security.admin-token",
+	"admin-client-ca":         "security.admin-client-ca",
+	"client-identities":       "security.client-identities",
+	"password-max-attempts":   "security.password-max-attempts",
+	"password-lockout":        "security.password-lockout",
+	"log-level":               "logging.log-level",
+	"log-format":              "logging.log-format",
+	"access-log-format":       "logging.access-log-format",
+	"access-log-file":         "logging.access-log-file",
+	"access-log-max-size":     "logging.access-log-max-size",
+	"access-log-max-backups":  "logging.access-log-max-backups",
+	"access-log-sample-rate":  "logging.access-log-sample-rate",
+	"access-log-redact-query": "logging.access-log-redact-query",
+	"otlp-endpoint":           "telemetry.otlp-endpoint",
+	"otlp-insecure":           "telemetry.otlp-insecure",
+	"service-name":            "telemetry.service-name",
+	"trace-sample-rate":       "telemetry.trace-sample-rate",
+}
+
+// bindSettings binds command-line flags and environment variables to configuration keys. The
+// environment variable names are based on flags, as in "SHORTY_DATABASE_FILE".
+func bindSettings(flags *pflag.FlagSet) error {
+	for flag, key := range settings {
+		if err := viper.BindPFlag(key, flags.Lookup(flag)); err != nil {
+			return err
+		}
+		env := fmt.Sprintf("SHORTY_%s", strings.ToUpper(strings.Replace(flag, "-", "_", -1)))
+		if err := viper.BindEnv(key, env); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// clientIdentitiesHook decodes client identities informed as string, in the same format used in
+// command-line, or as a list of those.
+func clientIdentitiesHook(from, to reflect.Type, data interface{}) (interface{}, error) {
+	if to != reflect.TypeOf(map[string]*shorty.ClientIdentity{}) {
+		return data, nil
+	}
+	switch value := data.(type) {
+	case string:
+		return shorty.ParseClientIdentities(value)
+	case []interface{}:
+		entries := []string{}
+		for _, entry := range value {
+			entries = append(entries, fmt.Sprintf("%v", entry))
+		}
+		return shorty.ParseClientIdentities(strings.Join(entries, ";"))
+	}
+	return data, nil
+}
+
+// bootstrapConfig using viper, reading the configuration file when informed. Command-line flags
+// overwrite environment variables, which overwrite the configuration file.
+func bootstrapConfig() (*shorty.Config, error) {
+	if configFile := viper.GetString("config"); configFile != "" {
+		viper.SetConfigFile(configFile)
+		if err := viper.ReadInConfig(); err != nil {
+			return nil, err
+		}
+	}
+
+	config := &shorty.Config{}
+	if err := viper.Unmarshal(config, viper.DecodeHook(
+		mapstructure.DecodeHookFunc(clientIdentitiesHook),
+	)); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
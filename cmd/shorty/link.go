@@ -0,0 +1,258 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"text/tabwriter"
+	"time"
+
+	"github.com/otaviof/shorty/pkg/client"
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"gopkg.in/yaml.v2"
+)
+
+// Output formats of link sub-commands.
+const (
+	outputTable = "table"
+	outputJSON  = "json"
+	outputYAML  = "yaml"
+)
+
+var linkCmd = &cobra.Command{
+	Use:   "link",
+	Short: "Manage short links on a remote Shorty instance.",
+	Long: `
+Manage short links on a remote Shorty instance, using its REST API. The server address and the
+bearer token are informed via "--server" and "--api-key", or "SHORTY_SERVER" and "SHORTY_API_KEY"
+environment variables. Results are shown as table, JSON or YAML. For instance:
+
+	shorty link create shorty https://github.com/otaviof/shorty --server http://127.0.0.1:8000
+	shorty link list --output json`,
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		// arguments are parsed at this point, usage is not helpful on API errors
+		cmd.SilenceUsage = true
+		switch output := viper.GetString("link.output"); output {
+		case outputTable, outputJSON, outputYAML:
+			return nil
+		default:
+			return fmt.Errorf("invalid output format: '%s'", output)
+		}
+	},
+}
+
+var linkCreateCmd = &cobra.Command{
+	Use:   "create <short> <url>",
+	RunE:  runLinkCreate,
+	Args:  cobra.ExactArgs(2),
+	Short: "Create a short link to the URL.",
+	Long: `
+Create a short link to the URL. With "--preview", visitors are shown a page with the destination
+before continuing, instead of being redirected. With "--max-clicks", the link is gone once used the
+informed amount of times, as for single-use download links. With "--password", visitors must inform
+the password before being redirected.`,
+}
+
+var linkGetCmd = &cobra.Command{
+	Use:   "get <short>",
+	RunE:  runLinkGet,
+	Args:  cobra.ExactArgs(1),
+	Short: "Show a short link, without following the redirect or accounting a click.",
+	Long: `
+Show a short link, without following the redirect or accounting a click. The link is looked up on
+the management API, which requires "--api-key", unless admin clients are authenticated by
+certificates. With "--resolve", only the long URL is shown, requested as visitors do, so
+"--api-key" is not required, but a click is accounted on links limited by maximum clicks.`,
+}
+
+var linkListCmd = &cobra.Command{
+	Use:   "list",
+	RunE:  runLinkList,
+	Args:  cobra.NoArgs,
+	Short: "List short links, except deleted, ordered by short string.",
+}
+
+var linkDeleteCmd = &cobra.Command{
+	Use:   "delete <short>",
+	RunE:  runLinkDelete,
+	Args:  cobra.ExactArgs(1),
+	Short: "Delete a short link, moving it to trash.",
+}
+
+var linkStatsCmd = &cobra.Command{
+	Use:   "stats",
+	RunE:  runLinkStats,
+	Args:  cobra.NoArgs,
+	Short: "Show link statistics, accounted since the server started.",
+}
+
+// newClient instantiate the API client for the informed server and token.
+func newClient() (*client.Client, error) {
+	options := client.NewOptions()
+	options.Token = viper.GetString("link.api-key")
+	return client.NewClient(viper.GetString("link.server"), options)
+}
+
+// runLinkCreate creates the short link and shows it.
+func runLinkCreate(cmd *cobra.Command, args []string) error {
+	preview, _ := cmd.Flags().GetBool("preview")
+	maxClicks, _ := cmd.Flags().GetInt64("max-clicks")
+	password, _ := cmd.Flags().GetString("password")
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	link, err := c.CreateLink(context.Background(), &client.Link{
+		Short:     args[0],
+		URL:       args[1],
+		Preview:   preview,
+		Password:  password,
+		MaxClicks: maxClicks,
+	})
+	if err != nil {
+		return err
+	}
+	return printLinks(cmd.OutOrStdout(), link)
+}
+
+// runLinkGet shows the short link, or only the long URL it resolves to.
+func runLinkGet(cmd *cobra.Command, args []string) error {
+	resolve, _ := cmd.Flags().GetBool("resolve")
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	if resolve {
+		longURL, err := c.Resolve(context.Background(), args[0])
+		if err != nil {
+			return err
+		}
+		_, err = fmt.Fprintln(cmd.OutOrStdout(), longURL)
+		return err
+	}
+	link, err := c.Info(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+	return printLinks(cmd.OutOrStdout(), link)
+}
+
+// runLinkList shows all short links, fetched page by page.
+func runLinkList(cmd *cobra.Command, args []string) error {
+	pageSize, _ := cmd.Flags().GetInt("page-size")
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+
+	links := []*client.Link{}
+	it := c.List(context.Background(), pageSize)
+	for it.Next() {
+		links = append(links, it.Link())
+	}
+	if err = it.Err(); err != nil {
+		return err
+	}
+	return printLinks(cmd.OutOrStdout(), links...)
+}
+
+// runLinkDelete deletes the short link, and shows it.
+func runLinkDelete(cmd *cobra.Command, args []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	link, err := c.Delete(context.Background(), args[0])
+	if err != nil {
+		return err
+	}
+	return printLinks(cmd.OutOrStdout(), link)
+}
+
+// runLinkStats shows link statistics.
+func runLinkStats(cmd *cobra.Command, args []string) error {
+	c, err := newClient()
+	if err != nil {
+		return err
+	}
+	stats, err := c.Stats(context.Background())
+	if err != nil {
+		return err
+	}
+	return render(cmd.OutOrStdout(), stats, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "LINKS\tREDIRECTS\tMISSES\tCREATED\tREJECTIONS")
+		fmt.Fprintf(tw, "%d\t%d\t%d\t%d\t%d\n",
+			stats.Links, stats.Redirects, stats.Misses, stats.Created, stats.Rejections)
+	})
+}
+
+// printLinks shows links using the informed output format, a single link is shown as object.
+func printLinks(w io.Writer, links ...*client.Link) error {
+	var v interface{} = links
+	if len(links) == 1 {
+		v = links[0]
+	}
+	return render(w, v, func(tw *tabwriter.Writer) {
+		fmt.Fprintln(tw, "SHORT\tURL\tCREATED\tDELETED")
+		for _, link := range links {
+			fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+				link.Short, link.URL, timestamp(link.CreatedAt), timestamp(link.DeletedAt))
+		}
+	})
+}
+
+// render shows the value as JSON or YAML, or as table written by the informed function.
+func render(w io.Writer, v interface{}, table func(*tabwriter.Writer)) error {
+	switch viper.GetString("link.output") {
+	case outputJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case outputYAML:
+		return yaml.NewEncoder(w).Encode(v)
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		table(tw)
+		return tw.Flush()
+	}
+}
+
+// timestamp formats unix timestamp as RFC3339, dash when not set.
+func timestamp(unix int64) string {
+	if unix == 0 {
+		return "-"
+	}
+	return time.Unix(unix, 0).UTC().Format(time.RFC3339)
+}
+
+// init setup sub-commands command-line arguments.
+func init() {
+	linkFlags := linkCmd.PersistentFlags()
+	linkFlags.String("server", "http://127.0.0.1:8000", "Shorty server base URL")
+	linkFlags.String("api-key", "", "bearer token sent on Authorization header")
+	linkFlags.StringP("output", "o", outputTable, "output format: table, json or yaml")
+	for flag, env := range map[string]string{
+		"server":  "SHORTY_SERVER",
+		"api-key": "SHORTY_API_KEY",
+		"output":  "SHORTY_OUTPUT",
+	} {
+		key := "link." + flag
+		if err := viper.BindPFlag(key, linkFlags.Lookup(flag)); err != nil {
+			panic(err)
+		}
+		if err := viper.BindEnv(key, env); err != nil {
+			panic(err)
+		}
+	}
+
+	linkCreateCmd.Flags().Bool("preview", false, "show preview page instead of redirecting")
+	linkCreateCmd.Flags().Int64("max-clicks", 0, "clicks before the link is gone, zero is unlimited")
+	linkCreateCmd.Flags().String("password", "", "password required to follow the link, up to 72 bytes")
+	linkGetCmd.Flags().Bool("resolve", false, "show only the long URL, as visitors are redirected to")
+	linkListCmd.Flags().Int("page-size", 100, "amount of links fetched per request")
+
+	linkCmd.AddCommand(linkCreateCmd, linkGetCmd, linkListCmd, linkDeleteCmd, linkStatsCmd)
+	rootCmd.AddCommand(linkCmd)
+}
@@ -1,7 +1,7 @@
 package main
 
 import (
-	"strings"
+	"os"
 
 	shorty "github.com/otaviof/shorty/pkg/shorty"
 	"github.com/spf13/cobra"
@@ -29,6 +29,8 @@ After registering the short link, you can use "curl" again to follow the redirec
 
 	curl -L http://127.0.0.1:8000/shorty/shorty
 
+Short links can also be managed with "shorty link" sub-commands, against a running instance.
+
 Backend persistence is done using SQLite, you can inform more options in command-line to use an
 alternative database-file and connection flags. Short links can't be repeated, since it's a
 constraint in Shorty's table.`,
@@ -39,7 +41,10 @@ func runShortyApp(cmd *cobra.Command, args []string) {
 	var err error
 	var app *shorty.Shorty
 
-	config := bootstrapConfig()
+	config, err := bootstrapConfig()
+	if err != nil {
+		panic(err)
+	}
 	if err = config.Validate(); err != nil {
 		panic(err)
 	}
@@ -47,19 +52,10 @@ func runShortyApp(cmd *cobra.Command, args []string) {
 	if app, err = shorty.NewShorty(config); err != nil {
 		panic(err)
 	}
+	app.SetConfigLoader(bootstrapConfig)
 
-	app.Run()
-}
-
-// bootstrapConfig using viper, therefore environment variables can overwrite command-line flags.
-func bootstrapConfig() *shorty.Config {
-	return &shorty.Config{
-		Address:      viper.GetString("address"),
-		DatabaseFile: viper.GetString("database-file"),
-		IdleTimeout:  viper.GetInt("idle-timeout"),
-		ReadTimeout:  viper.GetInt("read-timeout"),
-		WriteTimeout: viper.GetInt("write-timeout"),
-		SQLiteFlags:  viper.GetString("sqlite-flags"),
+	if err = app.Run(); err != nil {
+		panic(err)
 	}
 }
 
@@ -67,26 +63,59 @@ func bootstrapConfig() *shorty.Config {
 func init() {
 	flags := rootCmd.PersistentFlags()
 
-	// setting up rules for environment variables
-	viper.SetEnvPrefix("shorty")
-	viper.AutomaticEnv()
-	viper.SetEnvKeyReplacer(strings.NewReplacer("-", "_"))
-
 	// command-line options
-	flags.String("address", "127.0.0.1:8000", "Listen address")
+	flags.String("config", "", "configuration file, YAML or TOML, reloaded on SIGHUP")
+	flags.String("address", "127.0.0.1:8000",
+		"Listen address, 'unix:/path.sock' for unix socket, or 'systemd:[name]' for socket activation")
+	flags.String("socket-mode", "0660", "unix socket file permissions, in octal")
+	flags.String("tls-cert", "", "TLS certificate file, enables HTTPS on listen address")
+	flags.String("tls-key", "", "TLS private key file")
+	flags.String("tls-redirect-address", "", "plain HTTP listen address redirecting to HTTPS")
+	flags.String("public-url", "", "base URL of short links, as 'https://example.com'")
+	flags.String("admin-address", "", "admin listen address for metrics, health, pprof and management")
+	flags.String("admin-client-ca", "", "CA bundle, requires client certificates on admin listener")
+	flags.String("client-identities", "",
+		"client certificate common-names to identities, as '<cn>=<identity>:<action>,...;...'")
 	flags.String("database-file", "", "database file path, use empty for in-memory only")
 	flags.Int("idle-timeout", 10, "HTTP connection idle-timeout in seconds")
 	flags.Int("read-timeout", 5, "HTTP connection read-timeout in seconds")
 	flags.Int("write-timeout", 30, "HTTP connection write-timeout in seconds")
+	flags.Int("shutdown-timeout", 20, "graceful shutdown timeout in seconds, to drain in-flight requests")
+	flags.Int("shutdown-delay", 0, "seconds to fail readiness before shutting down http server")
 	flags.String("sqlite-flags", "", "SQLite connection string flags")
-
-	if err := viper.BindPFlags(flags); err != nil {
+	flags.Bool("case-insensitive", false, "store and look up short strings case-insensitively")
+	flags.String("admin-token", "", "bearer token for admin endpoints, empty disables them")
+	flags.Int("trash-retention", 720, "hours to keep deleted short links, zero keeps forever")
+	flags.Int("password-max-attempts", 5, "failed password attempts per link before locking it")
+	flags.Int("password-lockout", 900, "seconds a link stays locked after failed password attempts")
+	flags.String("log-level", "info", "log level: trace, debug, info, warn, error, fatal or panic")
+	flags.String("log-format", "text", "log output format: text or json")
+	flags.String("access-log-format", "combined", "access log format: combined, json or off")
+	flags.String("access-log-file", "", "access log file, rotated by size, empty for standard output")
+	flags.Int("access-log-max-size", 100, "access log file size in megabytes before rotating")
+	flags.Int("access-log-max-backups", 5, "rotated access log files to keep")
+	flags.Float64("access-log-sample-rate", 1, "ratio of redirects written in access log, above 0 up to 1")
+	flags.Bool("access-log-redact-query", true, "redact query string values in access log URLs")
+	flags.String("otlp-endpoint", "", "OTLP/HTTP collector address, as 'host:port', enables tracing")
+	flags.Bool("otlp-insecure", false, "use plain HTTP to export traces to the collector")
+	flags.String("service-name", "shorty", "service name reported on traces")
+	flags.Float64("trace-sample-rate", 1, "ratio of traces started by this service, 0 to 1")
+
+	// setting up configuration file keys, environment variables and flags
+	if err := viper.BindPFlag("config", flags.Lookup("config")); err != nil {
+		panic(err)
+	}
+	if err := viper.BindEnv("config", "SHORTY_CONFIG"); err != nil {
+		panic(err)
+	}
+	if err := bindSettings(flags); err != nil {
 		panic(err)
 	}
 }
 
 func main() {
+	// errors are shown by cobra
 	if err := rootCmd.Execute(); err != nil {
-		panic(err)
+		os.Exit(1)
 	}
 }
@@ -0,0 +1,184 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	shorty "github.com/otaviof/shorty/pkg/shorty"
+	"github.com/sirupsen/logrus"
+	"github.com/spf13/cobra"
+)
+
+var exportCmd = &cobra.Command{
+	Use:   "export",
+	RunE:  runExport,
+	Args:  cobra.NoArgs,
+	Short: "Export all short links from configured database.",
+	Long: `
+Export all short links from configured database, in CSV, JSON or NDJSON formats. Entries are
+streamed from the database, so large tables don't need to fit in memory. For instance:
+
+	shorty export --database-file /var/lib/shorty/shorty.sqlite --format csv > shorty.csv`,
+}
+
+var importCmd = &cobra.Command{
+	Use:   "import",
+	RunE:  runImport,
+	Args:  cobra.NoArgs,
+	Short: "Import short links into configured database.",
+	Long: `
+Import short links into configured database, from CSV, JSON or NDJSON formats. All entries are
+stored in a single transaction, so a failing import does not leave partial data behind. When a short
+string already exists, "--on-conflict" defines if the entry is skipped, overwrites the existing one,
+or fails the import. For instance:
+
+	shorty import --database-file /var/lib/shorty/shorty.sqlite --format csv < shorty.csv`,
+}
+
+// toolConfig bootstraps runtime config for command-line tools, configuring the logger level and
+// format alike.
+func toolConfig() (*shorty.Config, error) {
+	config, err := bootstrapConfig()
+	if err != nil {
+		return nil, err
+	}
+	if err = shorty.SetLogging(config.LogLevel, config.LogFormat); err != nil {
+		return nil, err
+	}
+	return config, nil
+}
+
+// newPersistence opens persistence using runtime config, without applying migrations or changing
+// indexes, since the database may be in use by a running instance.
+func newPersistence() (*shorty.Persistence, error) {
+	config, err := toolConfig()
+	if err != nil {
+		return nil, err
+	}
+	return shorty.OpenPersistence(config), nil
+}
+
+// newMigratedPersistence opens persistence like newPersistence, making sure the schema is up to
+// date, as entries are read and written using the current columns.
+func newMigratedPersistence() (*shorty.Persistence, error) {
+	p, err := newPersistence()
+	if err != nil {
+		return nil, err
+	}
+	if err = p.Migrated(context.Background()); err != nil {
+		p.Close()
+		return nil, fmt.Errorf("database schema is not up to date, start shorty to migrate: %s", err)
+	}
+	return p, nil
+}
+
+// runExport writes all entries to the output file, using the informed format. The database is
+// opened before the output file is created, and on failure the output file is removed, so no empty
+// or partial export is left behind.
+func runExport(cmd *cobra.Command, args []string) (err error) {
+	flags := cmd.Flags()
+	format, _ := flags.GetString("format")
+	file, _ := flags.GetString("file")
+
+	p, err := newMigratedPersistence()
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	var w io.Writer = os.Stdout
+	if file != "-" {
+		var f *os.File
+		if f, err = os.Create(file); err != nil {
+			return err
+		}
+		w = f
+		defer func() {
+			if closeErr := f.Close(); err == nil {
+				err = closeErr
+			}
+			if err != nil {
+				_ = os.Remove(file)
+			}
+		}()
+	}
+
+	count, err := export(p, w, format)
+	if err != nil {
+		return err
+	}
+	shorty.Logger().WithField("count", count).Info("Entries are exported")
+	return nil
+}
+
+// export encodes all entries on the writer, returns the amount of entries written.
+func export(p *shorty.Persistence, w io.Writer, format string) (int, error) {
+	enc, err := shorty.NewEncoder(w, format)
+	if err != nil {
+		return 0, err
+	}
+	count := 0
+	if err = p.Each(context.Background(), func(s *shorty.Shortened) error {
+		count++
+		return enc.Encode(s)
+	}); err != nil {
+		return count, err
+	}
+	return count, enc.Close()
+}
+
+// runImport reads entries from the input file, using the informed format, and stores them.
+func runImport(cmd *cobra.Command, args []string) error {
+	flags := cmd.Flags()
+	format, _ := flags.GetString("format")
+	file, _ := flags.GetString("file")
+	onConflict, _ := flags.GetString("on-conflict")
+
+	var r io.Reader = os.Stdin
+	if file != "-" {
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	dec, err := shorty.NewDecoder(r, format)
+	if err != nil {
+		return err
+	}
+	p, err := newMigratedPersistence()
+	if err != nil {
+		return err
+	}
+	defer p.Close()
+
+	stats, err := p.Import(context.Background(), dec, onConflict)
+	if err != nil {
+		return err
+	}
+	shorty.Logger().WithFields(logrus.Fields{
+		"imported": stats.Imported,
+		"skipped":  stats.Skipped,
+		"invalid":  stats.Invalid,
+	}).Info("Entries are imported")
+	return nil
+}
+
+// init setup sub-commands command-line arguments.
+func init() {
+	exportFlags := exportCmd.Flags()
+	exportFlags.String("format", shorty.FormatJSON, "output format: csv, json or ndjson")
+	exportFlags.String("file", "-", "output file path, use dash for standard output")
+
+	importFlags := importCmd.Flags()
+	importFlags.String("format", shorty.FormatJSON, "input format: csv, json or ndjson")
+	importFlags.String("file", "-", "input file path, use dash for standard input")
+	importFlags.String("on-conflict", shorty.OnConflictSkip,
+		"when short string already exists: skip, overwrite or fail")
+
+	rootCmd.AddCommand(exportCmd, importCmd)
+}
@@ -0,0 +1,278 @@
+// Package client is a Go client for Shorty's REST API.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+const (
+	// linkPath path of link management endpoints.
+	linkPath = "/shorty/"
+	// defaultPageSize amount of links fetched per page, when not informed.
+	defaultPageSize = 100
+)
+
+// Link short link, as represented on Shorty's API.
+type Link struct {
+	Short     string `json:"short,omitempty" yaml:"short"`                     // short string
+	URL       string `json:"url" yaml:"url"`                                   // long URL
+	CreatedAt int64  `json:"created_at,omitempty" yaml:"created_at"`           // created timestamp
+	DeletedAt int64  `json:"deleted_at,omitempty" yaml:"deleted_at,omitempty"` // deleted timestamp
+	Preview   bool   `json:"preview,omitempty" yaml:"preview,omitempty"`       // shows preview page
+	Protected bool   `json:"protected,omitempty" yaml:"protected,omitempty"`   // requires password
+	MaxClicks int64  `json:"max_clicks,omitempty" yaml:"max_clicks,omitempty"` // zero is unlimited
+	Clicks    int64  `json:"clicks,omitempty" yaml:"clicks,omitempty"`         // clicks accounted
+	Password  string `json:"password,omitempty" yaml:"-"`                      // informed on create
+}
+
+// Options client settings.
+type Options struct {
+	HTTPClient *http.Client  // underlying client, as for client certificates
+	Token      string        // bearer token, sent on "Authorization" header when informed
+	MaxRetries int           // retries of idempotent requests failing with server errors, or zero
+	MinBackoff time.Duration // wait before the first retry, doubled on each retry
+	MaxBackoff time.Duration // maximum wait between retries
+}
+
+// NewOptions instantiate options with default values.
+func NewOptions() *Options {
+	return &Options{
+		HTTPClient: &http.Client{Timeout: 30 * time.Second},
+		MaxRetries: 3,
+		MinBackoff: 100 * time.Millisecond,
+		MaxBackoff: 2 * time.Second,
+	}
+}
+
+// Client Shorty's API client, safe for concurrent use.
+type Client struct {
+	baseURL    *url.URL     // server address
+	httpClient *http.Client // client not following redirects
+	options    *Options     // client settings
+}
+
+// Create registers a link from short string to long URL.
+func (c *Client) Create(ctx context.Context, short, longURL string) (*Link, error) {
+	return c.CreateLink(ctx, &Link{Short: short, URL: longURL})
+}
+
+// CreateLink registers the link, as in a link showing the preview page instead of redirecting,
+// protected by password, or limited by maximum clicks.
+func (c *Client) CreateLink(ctx context.Context, link *Link) (*Link, error) {
+	payload := &Link{
+		URL:       link.URL,
+		Preview:   link.Preview,
+		Password:  link.Password,
+		MaxClicks: link.MaxClicks,
+	}
+	res, err := c.do(ctx, http.MethodPost, shortPath(link.Short), payload)
+	if err != nil {
+		return nil, err
+	}
+	created := &Link{}
+	return created, decode(res, http.StatusCreated, created)
+}
+
+// Info looks the link of a short string up, including deleted ones, on the management API, which
+// requires the token, or a client certificate, allowed to administer. The link is read as is, so
+// clicks are not accounted, and links protected by password or showing the preview page are read
+// as any other.
+func (c *Client) Info(ctx context.Context, short string) (*Link, error) {
+	res, err := c.do(ctx, http.MethodGet, shortPath(short)+"/info", nil)
+	if err != nil {
+		return nil, err
+	}
+	link := &Link{}
+	return link, decode(res, http.StatusOK, link)
+}
+
+// Resolve returns the long URL a short string leads to, requesting the short link as visitors do,
+// without following the redirect, so the token is not required. Resolving accounts a click on links
+// limited by maximum clicks, and links showing the preview page resolve to the URL informed on it,
+// or continue from it when the URL is concealed. Unknown links are not found, links protected by
+// password are unauthorized, and deleted links, or links without clicks left, are gone.
+func (c *Client) Resolve(ctx context.Context, short string) (string, error) {
+	res, err := c.do(ctx, http.MethodGet, shortPath(short), nil)
+	if err != nil {
+		return "", err
+	}
+	switch res.StatusCode {
+	case http.StatusNoContent:
+		res.Body.Close()
+		return "", &Error{StatusCode: http.StatusNotFound, Message: "short link is not found"}
+	case http.StatusOK:
+		link := &Link{}
+		if err = decode(res, http.StatusOK, link); err != nil {
+			return "", err
+		}
+		if link.URL != "" {
+			return link.URL, nil
+		}
+		// preview conceals the URL of links limited by maximum clicks, continuing accounts the click
+		if res, err = c.do(ctx, http.MethodPost, shortPath(short)+"/continue", nil); err != nil {
+			return "", err
+		}
+		return location(res, http.StatusSeeOther)
+	default:
+		return location(res, http.StatusTemporaryRedirect)
+	}
+}
+
+// Delete moves the link to trash, returning its contents.
+func (c *Client) Delete(ctx context.Context, short string) (*Link, error) {
+	res, err := c.do(ctx, http.MethodDelete, shortPath(short), nil)
+	if err != nil {
+		return nil, err
+	}
+	link := &Link{}
+	return link, decode(res, http.StatusOK, link)
+}
+
+// List iterates over links, except deleted, ordered by short string. Pages of informed size are
+// fetched as the iteration advances, zero uses the default size.
+func (c *Client) List(ctx context.Context, pageSize int) *Iterator {
+	if pageSize <= 0 {
+		pageSize = defaultPageSize
+	}
+	query := url.Values{"limit": {fmt.Sprint(pageSize)}}
+	return &Iterator{ctx: ctx, client: c, next: fmt.Sprintf("%s?%s", linkPath, query.Encode())}
+}
+
+// idempotentMethods methods safe to repeat, only those are retried.
+var idempotentMethods = map[string]bool{
+	http.MethodGet:    true,
+	http.MethodHead:   true,
+	http.MethodPut:    true,
+	http.MethodDelete: true,
+}
+
+// do executes the request on reference, relative to base URL, encoding payload as JSON when
+// informed. Requests with idempotent methods failing with server errors are retried with
+// exponential backoff, the last response is returned when retries are exhausted. Others are not
+// retried, since the server may have handled them already.
+func (c *Client) do(
+	ctx context.Context,
+	method string,
+	ref string,
+	payload interface{},
+) (*http.Response, error) {
+	var body []byte
+	var err error
+
+	if payload != nil {
+		if body, err = json.Marshal(payload); err != nil {
+			return nil, err
+		}
+	}
+	target, err := c.baseURL.Parse(ref)
+	if err != nil {
+		return nil, err
+	}
+
+	backoff := c.options.MinBackoff
+	for attempt := 0; ; attempt++ {
+		var reader io.Reader
+		if body != nil {
+			reader = bytes.NewReader(body)
+		}
+		req, err := http.NewRequestWithContext(ctx, method, target.String(), reader)
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+		if c.options.Token != "" {
+			req.Header.Set("Authorization", "Bearer "+c.options.Token)
+		}
+
+		res, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if res.StatusCode < http.StatusInternalServerError || !idempotentMethods[method] ||
+			attempt >= c.options.MaxRetries {
+			return res, nil
+		}
+		_, _ = io.Copy(ioutil.Discard, res.Body)
+		res.Body.Close()
+
+		if err = wait(ctx, backoff); err != nil {
+			return nil, err
+		}
+		if backoff *= 2; backoff > c.options.MaxBackoff {
+			backoff = c.options.MaxBackoff
+		}
+	}
+}
+
+// wait sleeps for the informed duration, or until context is done.
+func wait(ctx context.Context, d time.Duration) error {
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-timer.C:
+		return nil
+	}
+}
+
+// decode closes the response after decoding its body on v, when informed and the status code is
+// expected. Other status codes are decoded as error.
+func decode(res *http.Response, expected int, v interface{}) error {
+	defer res.Body.Close()
+	if res.StatusCode != expected {
+		return newError(res)
+	}
+	if v == nil {
+		return nil
+	}
+	return json.NewDecoder(res.Body).Decode(v)
+}
+
+// location closes the response, returning its "Location" header when the status code is expected.
+// Other status codes are decoded as error.
+func location(res *http.Response, expected int) (string, error) {
+	if err := decode(res, expected, nil); err != nil {
+		return "", err
+	}
+	return res.Header.Get("Location"), nil
+}
+
+// shortPath path of a short string endpoint.
+func shortPath(short string) string {
+	return linkPath + url.PathEscape(short)
+}
+
+// NewClient instantiate a client for the server on base URL, as in "http://127.0.0.1:8000", using
+// default options when nil. Redirects are never followed.
+func NewClient(baseURL string, options *Options) (*Client, error) {
+	parsed, err := url.Parse(baseURL)
+	if err != nil {
+		return nil, err
+	}
+	if parsed.Scheme == "" || parsed.Host == "" {
+		return nil, fmt.Errorf("invalid base URL: '%s'", baseURL)
+	}
+	if options == nil {
+		options = NewOptions()
+	}
+	httpClient := &http.Client{}
+	if options.HTTPClient != nil {
+		*httpClient = *options.HTTPClient
+	}
+	httpClient.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &Client{baseURL: parsed, httpClient: httpClient, options: options}, nil
+}
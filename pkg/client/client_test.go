@@ -0,0 +1,267 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/otaviof/shorty/pkg/shorty"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	short   = "abc"
+	longURL = "http://x.y.z"
+	token   = "token"
+)
+
+// flakyServer serves the routes of the application, failing the informed amount of requests
+// with service unavailable first, and keeping the authorization headers received.
+type flakyServer struct {
+	mu             sync.Mutex
+	router         http.Handler
+	failures       int      // requests still to fail
+	authorizations []string // authorization headers received
+}
+
+// ServeHTTP fails the request while failures are pending, or delegates to the router.
+func (f *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	f.authorizations = append(f.authorizations, r.Header.Get("Authorization"))
+	failing := f.failures > 0
+	if failing {
+		f.failures--
+	}
+	f.mu.Unlock()
+
+	if failing {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		_, _ = w.Write([]byte(`{"msg":"try again later"}`))
+		return
+	}
+	f.router.ServeHTTP(w, r)
+}
+
+// fail sets the amount of requests to fail.
+func (f *flakyServer) fail(failures int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failures = failures
+}
+
+// newTestServer starts a server with the routes of the application, guarded by the admin token, on
+// a database file of its own.
+func newTestServer(t *testing.T, databaseFile string) (*httptest.Server, *flakyServer) {
+	_ = os.Remove(databaseFile)
+	config := shorty.NewConfig()
+	config.DatabaseFile = databaseFile
+	config.AdminToken = token
+	p, err := shorty.NewPersistence(config)
+	assert.Nil(t, err)
+	t.Cleanup(p.Close)
+
+	flaky := &flakyServer{router: shorty.NewRouter(config, p)}
+	server := httptest.NewServer(flaky)
+	t.Cleanup(server.Close)
+	return server, flaky
+}
+
+// newTestClient creates a client for the server, with short backoff and the informed token.
+func newTestClient(t *testing.T, server *httptest.Server, token string) *Client {
+	options := NewOptions()
+	options.Token = token
+	options.MinBackoff = time.Millisecond
+	options.MaxBackoff = 5 * time.Millisecond
+	c, err := NewClient(server.URL, options)
+	assert.Nil(t, err)
+	return c
+}
+
+func TestNewClient(t *testing.T) {
+	_, err := NewClient("127.0.0.1:8000", nil)
+	assert.NotNil(t, err)
+
+	c, err := NewClient("http://127.0.0.1:8000", nil)
+	assert.Nil(t, err)
+	assert.NotNil(t, c.httpClient.CheckRedirect)
+	assert.Nil(t, NewOptions().HTTPClient.CheckRedirect)
+}
+
+func TestClientLink(t *testing.T) {
+	server, _ := newTestServer(t, "/var/tmp/shorty-test-client.sqlite")
+	c := newTestClient(t, server, token)
+	anonymous := newTestClient(t, server, "")
+	ctx := context.Background()
+
+	link, err := anonymous.Create(ctx, short, longURL)
+	assert.Nil(t, err)
+	assert.Equal(t, short, link.Short)
+	assert.Equal(t, longURL, link.URL)
+	assert.True(t, link.CreatedAt > 0)
+
+	_, err = anonymous.Create(ctx, short, longURL)
+	assert.True(t, IsConflict(err))
+
+	link, err = c.Info(ctx, short)
+	assert.Nil(t, err)
+	assert.Equal(t, longURL, link.URL)
+
+	t.Log("Looking links up must require the token")
+	_, err = anonymous.Info(ctx, short)
+	assert.True(t, IsUnauthorized(err))
+
+	t.Log("Resolve must return the long URL without the token, not following the redirect")
+	resolved, err := anonymous.Resolve(ctx, short)
+	assert.Nil(t, err)
+	assert.Equal(t, longURL, resolved)
+	_, err = anonymous.Resolve(ctx, "missing")
+	assert.True(t, IsNotFound(err))
+
+	_, err = anonymous.Delete(ctx, short)
+	assert.True(t, IsUnauthorized(err))
+	link, err = c.Delete(ctx, short)
+	assert.Nil(t, err)
+	assert.True(t, link.DeletedAt > 0)
+
+	_, err = anonymous.Resolve(ctx, short)
+	assert.True(t, IsGone(err))
+	link, err = c.Info(ctx, short)
+	assert.Nil(t, err)
+	assert.True(t, link.DeletedAt > 0)
+	_, err = c.Delete(ctx, short)
+	assert.True(t, IsNotFound(err))
+	_, err = c.Info(ctx, "missing")
+	assert.True(t, IsNotFound(err))
+
+	t.Log("Links showing preview page must be looked up and resolved as well")
+	link, err = c.CreateLink(ctx, &Link{Short: "preview", URL: longURL, Preview: true})
+	assert.Nil(t, err)
+	assert.True(t, link.Preview)
+	link, err = c.Info(ctx, "preview")
+	assert.Nil(t, err)
+	assert.True(t, link.Preview)
+	resolved, err = anonymous.Resolve(ctx, "preview")
+	assert.Nil(t, err)
+	assert.Equal(t, longURL, resolved)
+
+	t.Log("Links protected by password can't be resolved without it, unlike looked up")
+	link, err = c.CreateLink(ctx, &Link{Short: "protected", URL: longURL, Password: "secret"})
+	assert.Nil(t, err)
+	assert.True(t, link.Protected)
+	assert.Empty(t, link.Password)
+	for _, resolver := range []*Client{anonymous, c} {
+		_, err = resolver.Resolve(ctx, "protected")
+		assert.True(t, IsUnauthorized(err))
+	}
+	link, err = c.Info(ctx, "protected")
+	assert.Nil(t, err)
+	assert.True(t, link.Protected)
+	assert.Equal(t, longURL, link.URL)
+
+	t.Log("Looking links up must not account clicks, while resolving does")
+	link, err = c.CreateLink(ctx, &Link{Short: "once", URL: longURL, MaxClicks: 1})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), link.MaxClicks)
+	for i := 0; i < 3; i++ {
+		link, err = c.Info(ctx, "once")
+		assert.Nil(t, err)
+		assert.Equal(t, int64(0), link.Clicks)
+	}
+	resolved, err = anonymous.Resolve(ctx, "once")
+	assert.Nil(t, err)
+	assert.Equal(t, longURL, resolved)
+	_, err = anonymous.Resolve(ctx, "once")
+	assert.True(t, IsGone(err))
+
+	t.Log("Links showing preview page, limited by maximum clicks, must continue from it")
+	_, err = c.CreateLink(ctx, &Link{Short: "preview-once", URL: longURL, Preview: true, MaxClicks: 1})
+	assert.Nil(t, err)
+	resolved, err = anonymous.Resolve(ctx, "preview-once")
+	assert.Nil(t, err)
+	assert.Equal(t, longURL, resolved)
+	_, err = anonymous.Resolve(ctx, "preview-once")
+	assert.True(t, IsGone(err))
+}
+
+func TestClientErrors(t *testing.T) {
+	server, _ := newTestServer(t, "/var/tmp/shorty-test-client-errors.sqlite")
+	c := newTestClient(t, server, token)
+
+	t.Log("Errors must carry the message informed by the server")
+	_, err := c.Create(context.Background(), short, "http://localhost/path")
+	assert.True(t, IsInvalid(err))
+	apiErr, ok := err.(*Error)
+	assert.True(t, ok)
+	assert.Equal(t, http.StatusBadRequest, apiErr.StatusCode)
+	assert.Equal(t, "redirects to localhost are not allowed", apiErr.Message)
+	assert.Equal(t, "shorty: redirects to localhost are not allowed (400)", err.Error())
+
+	_, err = c.Create(context.Background(), "_reserved", longURL)
+	assert.True(t, IsInvalid(err))
+}
+
+func TestClientList(t *testing.T) {
+	server, _ := newTestServer(t, "/var/tmp/shorty-test-client-list.sqlite")
+	c := newTestClient(t, server, token)
+	ctx := context.Background()
+
+	for _, s := range []string{"e", "b", "d", "a", "c"} {
+		_, err := c.Create(ctx, s, longURL)
+		assert.Nil(t, err)
+	}
+	_, err := c.Delete(ctx, "c")
+	assert.Nil(t, err)
+
+	for _, pageSize := range []int{0, 1, 2, 4} {
+		shorts := []string{}
+		it := c.List(ctx, pageSize)
+		for it.Next() {
+			shorts = append(shorts, it.Link().Short)
+		}
+		assert.Nil(t, it.Err())
+		assert.Equal(t, []string{"a", "b", "d", "e"}, shorts, "page size %d", pageSize)
+	}
+
+	t.Log("Iteration must stop on errors")
+	it := c.List(ctx, 1001)
+	assert.False(t, it.Next())
+	assert.True(t, IsInvalid(it.Err()))
+}
+
+func TestClientRetry(t *testing.T) {
+	server, flaky := newTestServer(t, "/var/tmp/shorty-test-client-retry.sqlite")
+	c := newTestClient(t, server, token)
+	ctx := context.Background()
+
+	t.Log("Server errors on requests not idempotent must not be retried")
+	flaky.fail(1)
+	_, err := c.Create(ctx, short, longURL)
+	assert.Equal(t, &Error{StatusCode: http.StatusServiceUnavailable, Message: "try again later"}, err)
+	assert.Len(t, flaky.authorizations, 1)
+	_, err = c.Create(ctx, short, longURL)
+	assert.Nil(t, err)
+
+	t.Log("Server errors must be retried, informing the token on every attempt")
+	flaky.authorizations = nil
+	flaky.fail(2)
+	_, err = c.Info(ctx, short)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"Bearer token", "Bearer token", "Bearer token"}, flaky.authorizations)
+
+	t.Log("Last server error must be returned when retries are exhausted")
+	flaky.fail(c.options.MaxRetries + 1)
+	_, err = c.Info(ctx, short)
+	assert.Equal(t, &Error{StatusCode: http.StatusServiceUnavailable, Message: "try again later"}, err)
+
+	t.Log("Retries must stop when context is done")
+	c.options.MinBackoff, c.options.MaxBackoff = time.Minute, time.Minute
+	flaky.fail(1)
+	ctx, cancel := context.WithTimeout(ctx, 50*time.Millisecond)
+	defer cancel()
+	_, err = c.Info(ctx, short)
+	assert.Equal(t, context.DeadlineExceeded, err)
+}
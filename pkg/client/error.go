@@ -0,0 +1,69 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+)
+
+// maxErrorBody maximum amount of bytes read from error responses.
+const maxErrorBody = 64 * 1024
+
+// Error error response of Shorty's API, carrying the message informed by the server.
+type Error struct {
+	StatusCode int    `json:"-"`   // response status code
+	Message    string `json:"msg"` // error message
+}
+
+// Error returns the error message and status code.
+func (e *Error) Error() string {
+	return fmt.Sprintf("shorty: %s (%d)", e.Message, e.StatusCode)
+}
+
+// newError reads the error response body, falling back to status text when the server does not
+// inform a message.
+func newError(res *http.Response) error {
+	e := &Error{StatusCode: res.StatusCode}
+	body, err := ioutil.ReadAll(io.LimitReader(res.Body, maxErrorBody))
+	if err == nil && len(body) > 0 {
+		_ = json.Unmarshal(body, e)
+	}
+	if e.Message == "" {
+		e.Message = http.StatusText(res.StatusCode)
+	}
+	return e
+}
+
+// hasStatus checks if error is a API error with informed status code.
+func hasStatus(err error, status int) bool {
+	var e *Error
+	return errors.As(err, &e) && e.StatusCode == status
+}
+
+// IsNotFound checks if error is caused by a unknown short string.
+func IsNotFound(err error) bool {
+	return hasStatus(err, http.StatusNotFound)
+}
+
+// IsConflict checks if error is caused by a short string already registered.
+func IsConflict(err error) bool {
+	return hasStatus(err, http.StatusConflict)
+}
+
+// IsGone checks if error is caused by a deleted short string.
+func IsGone(err error) bool {
+	return hasStatus(err, http.StatusGone)
+}
+
+// IsInvalid checks if error is caused by a request not passing validation.
+func IsInvalid(err error) bool {
+	return hasStatus(err, http.StatusBadRequest) || hasStatus(err, http.StatusUnprocessableEntity)
+}
+
+// IsUnauthorized checks if error is caused by a link protected by password.
+func IsUnauthorized(err error) bool {
+	return hasStatus(err, http.StatusUnauthorized)
+}
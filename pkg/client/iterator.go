@@ -0,0 +1,69 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// Iterator iterates over links, fetching pages on demand.
+type Iterator struct {
+	ctx    context.Context
+	client *Client
+	next   string  // reference of the next page, empty when the last page is fetched
+	page   []*Link // links of current page not yet iterated
+	link   *Link   // current link
+	err    error   // error fetching pages
+}
+
+// Next advances to the next link, returns false when links are exhausted or on error, checked
+// with Err.
+func (i *Iterator) Next() bool {
+	for len(i.page) == 0 {
+		if i.err != nil || i.next == "" {
+			return false
+		}
+		i.fetch()
+	}
+	i.link, i.page = i.page[0], i.page[1:]
+	return true
+}
+
+// Link returns the current link.
+func (i *Iterator) Link() *Link {
+	return i.link
+}
+
+// Err returns the error interrupting the iteration, if any.
+func (i *Iterator) Err() error {
+	return i.err
+}
+
+// fetch reads the next page, following the reference of the page after it.
+func (i *Iterator) fetch() {
+	res, err := i.client.do(i.ctx, http.MethodGet, i.next, nil)
+	if err != nil {
+		i.err = err
+		return
+	}
+	i.next = nextPage(res.Header.Get("Link"))
+	i.page = nil
+	i.err = decode(res, http.StatusOK, &i.page)
+}
+
+// nextPage extracts the reference of the next page out of "Link" header, empty when not found.
+func nextPage(header string) string {
+	for _, link := range strings.Split(header, ",") {
+		parts := strings.Split(link, ";")
+		ref := strings.TrimSpace(parts[0])
+		if !strings.HasPrefix(ref, "<") || !strings.HasSuffix(ref, ">") {
+			continue
+		}
+		for _, param := range parts[1:] {
+			if strings.TrimSpace(param) == `rel="next"` {
+				return strings.Trim(ref, "<>")
+			}
+		}
+	}
+	return ""
+}
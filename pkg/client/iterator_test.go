@@ -0,0 +1,15 @@
+package client
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIteratorNextPage(t *testing.T) {
+	assert.Equal(t, "", nextPage(""))
+	assert.Equal(t, "/shorty/?after=b&limit=2", nextPage(`</shorty/?after=b&limit=2>; rel="next"`))
+	assert.Equal(t, "/next", nextPage(`</prev>; rel="prev", </next>; rel="next"`))
+	assert.Equal(t, "", nextPage(`</prev>; rel="prev"`))
+	assert.Equal(t, "", nextPage(`/next; rel="next"`))
+}
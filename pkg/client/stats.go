@@ -0,0 +1,79 @@
+package client
+
+import (
+	"context"
+	"net/http"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+)
+
+// metricsPath path of metrics endpoint, in Prometheus format.
+const metricsPath = "/metrics"
+
+// Stats link statistics of a server, counters are accounted since the server started.
+type Stats struct {
+	Links      int64 `json:"links" yaml:"links"`           // links, except deleted
+	Redirects  int64 `json:"redirects" yaml:"redirects"`   // redirects served
+	Misses     int64 `json:"misses" yaml:"misses"`         // redirects not served
+	Created    int64 `json:"created" yaml:"created"`       // links created
+	Rejections int64 `json:"rejections" yaml:"rejections"` // requests not passing validation
+}
+
+// Stats reads link statistics from the server metrics.
+func (c *Client) Stats(ctx context.Context) (*Stats, error) {
+	res, err := c.do(ctx, http.MethodGet, metricsPath, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.StatusCode != http.StatusOK {
+		return nil, newError(res)
+	}
+
+	parser := expfmt.TextParser{}
+	families, err := parser.TextToMetricFamilies(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	return &Stats{
+		Links:      sumMetric(families["shorty_links"], nil),
+		Redirects:  sumMetric(families["shorty_redirects_total"], nil),
+		Misses:     sumMetric(families["shorty_redirect_misses_total"], nil),
+		Created:    sumMetric(families["shorty_creates_total"], map[string]string{"outcome": "created"}),
+		Rejections: sumMetric(families["shorty_validation_rejections_total"], nil),
+	}, nil
+}
+
+// sumMetric sums the values of a counter or gauge family, of metrics carrying the informed labels.
+func sumMetric(family *dto.MetricFamily, labels map[string]string) int64 {
+	if family == nil {
+		return 0
+	}
+	var total float64
+	for _, m := range family.GetMetric() {
+		if !hasLabels(m, labels) {
+			continue
+		}
+		switch {
+		case m.Counter != nil:
+			total += m.Counter.GetValue()
+		case m.Gauge != nil:
+			total += m.Gauge.GetValue()
+		case m.Untyped != nil:
+			total += m.Untyped.GetValue()
+		}
+	}
+	return int64(total)
+}
+
+// hasLabels checks if metric carries all informed label values.
+func hasLabels(m *dto.Metric, labels map[string]string) bool {
+	matched := 0
+	for _, pair := range m.GetLabel() {
+		if value, found := labels[pair.GetName()]; found && value == pair.GetValue() {
+			matched++
+		}
+	}
+	return matched == len(labels)
+}
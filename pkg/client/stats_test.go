@@ -0,0 +1,52 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// metricsSample metrics as served by Shorty, trimmed.
+const metricsSample = `# HELP shorty_creates_total The number of link creation attempts, by outcome
+# TYPE shorty_creates_total counter
+shorty_creates_total{outcome="conflict"} 1
+shorty_creates_total{outcome="created"} 4
+shorty_creates_total{outcome="invalid"} 2
+# HELP shorty_links The total of links, except deleted
+# TYPE shorty_links gauge
+shorty_links 3
+# HELP shorty_redirect_misses_total The number of redirects not served, by reason
+# TYPE shorty_redirect_misses_total counter
+shorty_redirect_misses_total{reason="deleted"} 1
+shorty_redirect_misses_total{reason="not_found"} 2
+# HELP shorty_redirects_total The number of redirects served
+# TYPE shorty_redirects_total counter
+shorty_redirects_total 10
+# HELP shorty_validation_rejections_total The number of validation rejections, by reason
+# TYPE shorty_validation_rejections_total counter
+shorty_validation_rejections_total{reason="localhost"} 2
+`
+
+func TestClientStats(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != metricsPath {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		_, _ = w.Write([]byte(metricsSample))
+	}))
+	defer server.Close()
+
+	c := newTestClient(t, server, "")
+	stats, err := c.Stats(context.Background())
+	assert.Nil(t, err)
+	assert.Equal(t, &Stats{Links: 3, Redirects: 10, Misses: 3, Created: 4, Rejections: 2}, stats)
+
+	t.Log("Servers without metrics must fail with not found")
+	server.Config.Handler = http.NotFoundHandler()
+	_, err = c.Stats(context.Background())
+	assert.True(t, IsNotFound(err))
+}
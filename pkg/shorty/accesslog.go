@@ -0,0 +1,199 @@
+package shorty
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+// Access log formats.
+const (
+	AccessLogCombined = "combined"
+	AccessLogJSON     = "json"
+	AccessLogOff      = "off"
+)
+
+const (
+	// combinedTimeFormat timestamp format of Apache combined log format.
+	combinedTimeFormat = "02/Jan/2006:15:04:05 -0700"
+	// redacted replaces query string values, when redaction is enabled.
+	redacted = "REDACTED"
+)
+
+// AccessLogEntry represents a request in access log, in JSON format.
+type AccessLogEntry struct {
+	Time       time.Time `json:"time"`                 // request start time
+	RemoteAddr string    `json:"remote_addr"`          // client address
+	Method     string    `json:"method"`               // request method
+	URI        string    `json:"uri"`                  // request URI, query string can be redacted
+	Protocol   string    `json:"protocol"`             // request protocol
+	Status     int       `json:"status"`               // response status code
+	Bytes      int       `json:"bytes"`                // response body size
+	Referer    string    `json:"referer,omitempty"`    // referer header
+	UserAgent  string    `json:"user_agent,omitempty"` // user-agent header
+	LatencyMs  float64   `json:"latency_ms"`           // request latency in milliseconds
+	RequestID  string    `json:"request_id,omitempty"` // request ID
+	Location   string    `json:"location,omitempty"`   // redirect destination, query string can be redacted
+}
+
+// accessLogger writes one line per request, in combined or JSON format.
+type accessLogger struct {
+	mu         sync.Mutex
+	out        io.Writer // access log output
+	closer     io.Closer // closes output file, nil for standard output
+	format     string    // combined or json
+	sampleRate float64   // ratio of redirects logged, other requests are always logged
+	redact     bool      // redact query string values
+}
+
+// redactQuery replaces the query string values of informed URL, keeping the parameter names.
+func redactQuery(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.RawQuery == "" {
+		return rawURL
+	}
+
+	names := []string{}
+	for name := range u.Query() {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	query := []string{}
+	for _, name := range names {
+		query = append(query, fmt.Sprintf("%s=%s", url.QueryEscape(name), redacted))
+	}
+	u.RawQuery = strings.Join(query, "&")
+	return u.String()
+}
+
+// isRedirect checks if status is a redirect.
+func isRedirect(status int) bool {
+	return status >= http.StatusMultipleChoices && status < http.StatusBadRequest
+}
+
+// sampled decides if a request is logged, sampling applies only to redirects.
+func (a *accessLogger) sampled(status int) bool {
+	if !isRedirect(status) || a.sampleRate >= 1 {
+		return true
+	}
+	return rand.Float64() < a.sampleRate
+}
+
+// combined formats entry as Apache combined log format.
+func (a *accessLogger) combined(entry *AccessLogEntry) string {
+	bytes := "-"
+	if entry.Bytes > 0 {
+		bytes = fmt.Sprintf("%d", entry.Bytes)
+	}
+	return fmt.Sprintf("%s - - [%s] %q %d %s %q %q\n",
+		entry.RemoteAddr,
+		entry.Time.Format(combinedTimeFormat),
+		fmt.Sprintf("%s %s %s", entry.Method, entry.URI, entry.Protocol),
+		entry.Status,
+		bytes,
+		entry.Referer,
+		entry.UserAgent,
+	)
+}
+
+// write serializes the entry on configured format, and writes on output.
+func (a *accessLogger) write(entry *AccessLogEntry) error {
+	var line []byte
+	if a.format == AccessLogJSON {
+		var err error
+		if line, err = json.Marshal(entry); err != nil {
+			return err
+		}
+		line = append(line, '\n')
+	} else {
+		line = []byte(a.combined(entry))
+	}
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	_, err := a.out.Write(line)
+	return err
+}
+
+// handler middleware to write access log entries, after the request is served.
+func (a *accessLogger) handler(c *gin.Context) {
+	start := time.Now()
+	c.Next()
+
+	status := c.Writer.Status()
+	if !a.sampled(status) {
+		return
+	}
+
+	uri := c.Request.URL.RequestURI()
+	location := c.Writer.Header().Get("Location")
+	if a.redact {
+		uri = redactQuery(uri)
+		location = redactQuery(location)
+	}
+
+	entry := &AccessLogEntry{
+		Time:       start,
+		RemoteAddr: c.ClientIP(),
+		Method:     c.Request.Method,
+		URI:        uri,
+		Protocol:   c.Request.Proto,
+		Status:     status,
+		Bytes:      c.Writer.Size(),
+		Referer:    c.Request.Referer(),
+		UserAgent:  c.Request.UserAgent(),
+		LatencyMs:  float64(time.Since(start)) / float64(time.Millisecond),
+		RequestID:  c.GetString(requestIDKey),
+		Location:   location,
+	}
+	if entry.Bytes < 0 {
+		entry.Bytes = 0
+	}
+	if err := a.write(entry); err != nil {
+		logEntry(c.Request.Context()).WithError(err).Error("Error on writing access log")
+	}
+}
+
+// Close closes access log file, when in use.
+func (a *accessLogger) Close() error {
+	if a.closer == nil {
+		return nil
+	}
+	return a.closer.Close()
+}
+
+// newAccessLogger creates the access logger, writing on standard output or on a file rotated by
+// size. Returns nil when access log is disabled.
+func newAccessLogger(config *Config) *accessLogger {
+	if config.AccessLogFormat == AccessLogOff {
+		return nil
+	}
+
+	a := &accessLogger{
+		out:        os.Stdout,
+		format:     config.AccessLogFormat,
+		sampleRate: config.AccessLogSampleRate,
+		redact:     config.AccessLogRedactQuery,
+	}
+	if config.AccessLogFile != "" {
+		file := &lumberjack.Logger{
+			Filename:   config.AccessLogFile,
+			MaxSize:    config.AccessLogMaxSize,
+			MaxBackups: config.AccessLogMaxBackups,
+		}
+		a.out, a.closer = file, file
+	}
+	return a
+}
@@ -0,0 +1,113 @@
+package shorty
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const accessLogFile = "/var/tmp/shorty-test-access.log"
+
+func TestAccessLogRedactQuery(t *testing.T) {
+	assert.Equal(t, "http://x.y.z/path", redactQuery("http://x.y.z/path"))
+	assert.Equal(t, "http://x.y.z/path?a=REDACTED&token=REDACTED",
+		redactQuery("http://x.y.z/path?token=secret&a=1"))
+	assert.Equal(t, "/shorty/abc?q=REDACTED", redactQuery("/shorty/abc?q=1"))
+}
+
+// accessLogRouter router redirecting on "/redirect", and answering "/ok", logging on buffer.
+func accessLogRouter(a *accessLogger) *gin.Engine {
+	router := gin.New()
+	router.Use(requestID, a.handler)
+	router.GET("/redirect", func(c *gin.Context) {
+		c.Redirect(http.StatusTemporaryRedirect, "http://x.y.z/?token=secret")
+	})
+	router.GET("/ok", func(c *gin.Context) {
+		c.String(http.StatusOK, "ok")
+	})
+	return router
+}
+
+func TestAccessLogFormats(t *testing.T) {
+	var out bytes.Buffer
+	a := &accessLogger{out: &out, format: AccessLogCombined, sampleRate: 1, redact: true}
+	router := accessLogRouter(a)
+
+	req, err := http.NewRequest("GET", "/ok?q=1", nil)
+	assert.Nil(t, err)
+	req.Header.Set("User-Agent", "test-agent")
+	req.Header.Set("Referer", "http://referer")
+	recorderServeHTTP(router, req)
+
+	line := out.String()
+	assert.Contains(t, line, `"GET /ok?q=REDACTED HTTP/1.1" 200 2 "http://referer" "test-agent"`)
+	assert.True(t, strings.HasSuffix(line, "\n"))
+
+	t.Log("JSON format must carry request ID and redacted destination")
+	out.Reset()
+	a.format = AccessLogJSON
+	req, err = http.NewRequest("GET", "/redirect", nil)
+	assert.Nil(t, err)
+	req.Header.Set(requestIDHeader, "access-id")
+	recorderServeHTTP(router, req)
+
+	entry := &AccessLogEntry{}
+	assert.Nil(t, json.Unmarshal(out.Bytes(), entry))
+	assert.Equal(t, http.StatusTemporaryRedirect, entry.Status)
+	assert.Equal(t, "/redirect", entry.URI)
+	assert.Equal(t, "access-id", entry.RequestID)
+	assert.Equal(t, "http://x.y.z/?token=REDACTED", entry.Location)
+
+	a.redact = false
+	out.Reset()
+	recorderServeHTTP(router, req)
+	assert.Nil(t, json.Unmarshal(out.Bytes(), entry))
+	assert.Equal(t, "http://x.y.z/?token=secret", entry.Location)
+}
+
+func TestAccessLogSampling(t *testing.T) {
+	var out bytes.Buffer
+	a := &accessLogger{out: &out, format: AccessLogCombined, sampleRate: 0}
+	router := accessLogRouter(a)
+
+	for _, path := range []string{"/redirect", "/redirect", "/ok"} {
+		req, err := http.NewRequest("GET", path, nil)
+		assert.Nil(t, err)
+		recorderServeHTTP(router, req)
+	}
+
+	t.Log("Only redirects must be sampled")
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(t, lines, 1)
+	assert.Contains(t, lines[0], "GET /ok")
+}
+
+func TestAccessLogFile(t *testing.T) {
+	_ = os.Remove(accessLogFile)
+
+	config := NewConfig()
+	config.AccessLogFile = accessLogFile
+	config.AccessLogFormat = AccessLogJSON
+	assert.Nil(t, config.Validate())
+
+	a := newAccessLogger(config)
+	assert.NotNil(t, a)
+	req, err := http.NewRequest("GET", "/ok", nil)
+	assert.Nil(t, err)
+	recorderServeHTTP(accessLogRouter(a), req)
+	assert.Nil(t, a.Close())
+
+	contents, err := ioutil.ReadFile(accessLogFile)
+	assert.Nil(t, err)
+	assert.Contains(t, string(contents), `"uri":"/ok"`)
+
+	config.AccessLogFormat = AccessLogOff
+	assert.Nil(t, newAccessLogger(config))
+}
@@ -0,0 +1,209 @@
+package shorty
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Actions recorded in audit log.
+const (
+	AuditCreate  = "create"
+	AuditUpdate  = "update"
+	AuditDelete  = "delete"
+	AuditRestore = "restore"
+	AuditImport  = "import"
+	AuditPurge   = "purge"
+)
+
+const (
+	// actorKey gin context key for the authenticated actor name.
+	actorKey = "actor"
+	// anonymousActor actor name for unauthenticated requests.
+	anonymousActor = "anonymous"
+	// systemActor actor name for changes made outside of a request, like command-line and jobs.
+	systemActor = "system"
+)
+
+// Actor identifies who is changing a entry.
+type Actor struct {
+	Name string // actor name
+	IP   string // source IP address, when changing via HTTP
+}
+
+// actorContextKey context key to carry the actor.
+type actorContextKey struct{}
+
+// WithActor returns a copy of the context carrying the actor, to be recorded in audit log.
+func WithActor(ctx context.Context, actor *Actor) context.Context {
+	return context.WithValue(ctx, actorContextKey{}, actor)
+}
+
+// actorFromContext returns the actor in context, or system actor when not present.
+func actorFromContext(ctx context.Context) *Actor {
+	if actor, ok := ctx.Value(actorContextKey{}).(*Actor); ok {
+		return actor
+	}
+	return &Actor{Name: systemActor}
+}
+
+// AuditEntry represents a change on a entry, the audit log is append-only.
+type AuditEntry struct {
+	ID        int64  `json:"id"`                  // sequential identifier
+	Short     string `json:"short"`               // short string changed
+	Action    string `json:"action"`              // create, update, delete, restore, import or purge
+	Actor     string `json:"actor"`               // who made the change
+	SourceIP  string `json:"source_ip,omitempty"` // where the change came from
+	OldURL    string `json:"old_url,omitempty"`   // URL before the change
+	NewURL    string `json:"new_url,omitempty"`   // URL after the change
+	CreatedAt int64  `json:"created_at"`          // change timestamp
+	// Changes other attributes changed, like the preview flag
+	Changes []*AuditChange `json:"changes,omitempty"`
+}
+
+// AuditChange represents a attribute, other than the URL, changed on a entry.
+type AuditChange struct {
+	Field string `json:"field"` // attribute name
+	Old   string `json:"old"`   // value before the change
+	New   string `json:"new"`   // value after the change
+}
+
+// auditColumns columns needed to compose a AuditEntry instance, in the order expected by queryAudit.
+const auditColumns = "id, short, action, actor, source_ip, old_url, new_url, created_at, changes"
+
+// audit records a change, to be called within the same transaction of the change itself. Changed
+// attributes, other than the URL, are stored as JSON.
+func (p *Persistence) audit(
+	ctx context.Context, tx *sql.Tx, action, short, oldURL, newURL string, changes ...*AuditChange,
+) error {
+	encoded := ""
+	if len(changes) > 0 {
+		payload, err := json.Marshal(changes)
+		if err != nil {
+			return err
+		}
+		encoded = string(payload)
+	}
+	actor := actorFromContext(ctx)
+	query := `
+INSERT INTO audit(short, action, actor, source_ip, old_url, new_url, created_at, changes)
+VALUES (?, ?, ?, ?, ?, ?, ?, ?)`
+	_, err := tx.ExecContext(ctx, query, short, action, actor.Name, actor.IP, oldURL, newURL,
+		time.Now().Unix(), encoded)
+	return err
+}
+
+// History returns the audit log of a short string, oldest change first.
+func (p *Persistence) History(ctx context.Context, short string) ([]*AuditEntry, error) {
+	query := fmt.Sprintf(`
+SELECT %s
+  FROM audit
+ WHERE %s
+ ORDER BY id`, auditColumns, p.shortMatch())
+	return p.queryAudit(ctx, query, short)
+}
+
+// Audit returns the audit log between informed timestamps, oldest change first. Zero timestamps
+// are not applied as filter.
+func (p *Persistence) Audit(ctx context.Context, since, until int64) ([]*AuditEntry, error) {
+	query := fmt.Sprintf(`
+SELECT %s
+  FROM audit
+ WHERE (? = 0 OR created_at >= ?) AND (? = 0 OR created_at <= ?)
+ ORDER BY id`, auditColumns)
+	return p.queryAudit(ctx, query, since, since, until, until)
+}
+
+// queryAudit executes the query and scan all resulting audit entries.
+func (p *Persistence) queryAudit(ctx context.Context, query string, args ...interface{}) ([]*AuditEntry, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	slice := []*AuditEntry{}
+	for rows.Next() {
+		a := &AuditEntry{}
+		var changes string
+		if err = rows.Scan(&a.ID, &a.Short, &a.Action, &a.Actor, &a.SourceIP, &a.OldURL, &a.NewURL,
+			&a.CreatedAt, &changes); err != nil {
+			return nil, err
+		}
+		if changes != "" {
+			if err = json.Unmarshal([]byte(changes), &a.Changes); err != nil {
+				return nil, err
+			}
+		}
+		slice = append(slice, a)
+	}
+	return slice, rows.Err()
+}
+
+// History shows the changes on a given short string.
+func (h *Handler) History(c *gin.Context) {
+	short := c.Param("short")
+	slice, err := h.persistence.History(c.Request.Context(), short)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, h.mapErr(err))
+		return
+	}
+	logEntry(c.Request.Context()).WithFields(logrus.Fields{"short": short, "count": len(slice)}).
+		Debug("Found audit entries")
+	c.JSONP(http.StatusOK, slice)
+}
+
+// Audit shows the changes on all entries, optionally filtered by "since" and "until" query
+// parameters, informed as unix timestamps or RFC3339.
+func (h *Handler) Audit(c *gin.Context) {
+	var since, until int64
+	var err error
+
+	if since, err = parseTimestamp(c.Query("since")); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, h.mapErr(err))
+		return
+	}
+	if until, err = parseTimestamp(c.Query("until")); err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, h.mapErr(err))
+		return
+	}
+
+	slice, err := h.persistence.Audit(c.Request.Context(), since, until)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, h.mapErr(err))
+		return
+	}
+	logEntry(c.Request.Context()).WithField("count", len(slice)).Debug("Found audit entries")
+	c.JSONP(http.StatusOK, slice)
+}
+
+// actorContext returns the request context carrying the actor, authenticated or anonymous.
+func (h *Handler) actorContext(c *gin.Context) context.Context {
+	name := c.GetString(actorKey)
+	if name == "" {
+		name = anonymousActor
+	}
+	return WithActor(c.Request.Context(), &Actor{Name: name, IP: c.ClientIP()})
+}
+
+// parseTimestamp parses unix timestamp or RFC3339 formatted time, empty is parsed as zero.
+func parseTimestamp(value string) (int64, error) {
+	if value == "" {
+		return 0, nil
+	}
+	if timestamp, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return timestamp, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid timestamp '%s', use unix timestamp or RFC3339", value)
+	}
+	return t.Unix(), nil
+}
@@ -0,0 +1,174 @@
+package shorty
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuditParseTimestamp(t *testing.T) {
+	timestamp, err := parseTimestamp("")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), timestamp)
+
+	timestamp, err = parseTimestamp("1553442790")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1553442790), timestamp)
+
+	timestamp, err = parseTimestamp("2019-03-24T15:53:10Z")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1553442790), timestamp)
+
+	_, err = parseTimestamp("bogus")
+	assert.Error(t, err)
+}
+
+func TestAuditActorFromContext(t *testing.T) {
+	assert.Equal(t, systemActor, actorFromContext(context.Background()).Name)
+
+	ctx := WithActor(context.Background(), &Actor{Name: "actor", IP: "10.0.0.1"})
+	assert.Equal(t, &Actor{Name: "actor", IP: "10.0.0.1"}, actorFromContext(ctx))
+}
+
+func TestAuditPersistence(t *testing.T) {
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-audit.sqlite",
+	}}
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	ctx := WithActor(context.Background(), &Actor{Name: "actor", IP: "10.0.0.1"})
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: short, URL: longURL}))
+	assert.Nil(t, p.Update(ctx, short, "http://other.com", nil))
+	assert.Nil(t, p.Delete(ctx, short))
+	assert.Nil(t, p.Undelete(ctx, short))
+	assert.Nil(t, p.Delete(ctx, short))
+	purged, err := p.Purge(context.Background(), time.Now().Unix()+1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	t.Log("Failing mutations must not be recorded")
+	assert.Error(t, p.Update(ctx, short, longURL, nil))
+
+	history, err := p.History(ctx, short)
+	assert.Nil(t, err)
+	assert.Len(t, history, 6)
+
+	actions := []string{}
+	for _, a := range history {
+		actions = append(actions, a.Action)
+	}
+	assert.Equal(t, []string{
+		AuditCreate, AuditUpdate, AuditDelete, AuditRestore, AuditDelete, AuditPurge,
+	}, actions)
+
+	assert.Equal(t, "actor", history[1].Actor)
+	assert.Equal(t, "10.0.0.1", history[1].SourceIP)
+	assert.Equal(t, longURL, history[1].OldURL)
+	assert.Equal(t, "http://other.com", history[1].NewURL)
+	assert.Empty(t, history[1].Changes)
+	assert.Equal(t, systemActor, history[5].Actor)
+
+	all, err := p.Audit(ctx, history[0].CreatedAt, 0)
+	assert.Nil(t, err)
+	assert.Len(t, all, 6)
+	all, err = p.Audit(ctx, 0, history[0].CreatedAt-1)
+	assert.Nil(t, err)
+	assert.Len(t, all, 0)
+
+	t.Log("Audit log must be append-only")
+	_, err = p.db.Exec("DELETE FROM audit")
+	assert.Error(t, err)
+	_, err = p.db.Exec("UPDATE audit SET actor = 'bogus'")
+	assert.Error(t, err)
+}
+
+func TestAuditPreviewChange(t *testing.T) {
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-audit-preview.sqlite",
+	}}
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	ctx := context.Background()
+	enabled, disabled := true, false
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: short, URL: longURL}))
+	assert.Nil(t, p.Update(ctx, short, longURL, &enabled))
+	assert.Nil(t, p.Update(ctx, short, longURL, &enabled))
+	assert.Nil(t, p.Update(ctx, short, longURL, &disabled))
+
+	history, err := p.History(ctx, short)
+	assert.Nil(t, err)
+	assert.Len(t, history, 4)
+
+	t.Log("Toggling preview, without changing the URL, must be recorded")
+	assert.Equal(t, []*AuditChange{{Field: "preview", Old: "false", New: "true"}}, history[1].Changes)
+	assert.Empty(t, history[2].Changes)
+	assert.Equal(t, []*AuditChange{{Field: "preview", Old: "true", New: "false"}}, history[3].Changes)
+}
+
+func TestAuditHandler(t *testing.T) {
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-audit-handler.sqlite",
+	}}
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	h := NewHandler(p)
+
+	router := gin.Default()
+	router.POST("/shorty/:short", h.Create)
+	router.GET("/shorty/:short/history", h.History)
+	router.DELETE("/shorty/:short", adminAuth("secret"), h.Delete)
+	router.GET("/admin/audit", adminAuth("secret"), h.Audit)
+
+	payload := strings.NewReader(fmt.Sprintf("{\"url\":\"%s\"}", longURL))
+	req, err := http.NewRequest("POST", fmt.Sprintf("/shorty/%s", short), payload)
+	assert.Nil(t, err)
+	rr := recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	req, err = http.NewRequest("DELETE", fmt.Sprintf("/shorty/%s", short), nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("/shorty/%s/history", short), nil)
+	assert.Nil(t, err)
+	rr = recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	history := []*AuditEntry{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &history))
+	assert.Len(t, history, 2)
+	assert.Equal(t, anonymousActor, history[0].Actor)
+	assert.Equal(t, adminActor, history[1].Actor)
+
+	req, err = http.NewRequest("GET", "/admin/audit?since=bogus", nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	req, err = http.NewRequest("GET", "/admin/audit?since=2019-03-24T15:53:10Z", nil)
+	assert.Nil(t, err)
+	req.Header.Set("Authorization", "Bearer secret")
+	rr = recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &history))
+	assert.Len(t, history, 2)
+}
@@ -0,0 +1,66 @@
+package shorty
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// bearerPrefix authorization header prefix for bearer tokens.
+	bearerPrefix = "Bearer "
+	// adminActor actor name for requests authenticated with admin token.
+	adminActor = "admin"
+	// revealKey gin context key, set when the caller is allowed to reveal URLs of protected entries.
+	revealKey = "reveal"
+)
+
+// adminAuth middleware to authenticate admin requests using a bearer token. When token is not
+// configured, admin endpoints are disabled.
+func adminAuth(token string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if token == "" {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"msg": "admin endpoints are disabled"})
+			return
+		}
+
+		header := c.GetHeader("Authorization")
+		if !strings.HasPrefix(header, bearerPrefix) {
+			c.Header("WWW-Authenticate", "Bearer")
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"msg": "bearer token is required"})
+			return
+		}
+		if !bearerMatches(header, token) {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"msg": "invalid bearer token"})
+			return
+		}
+		c.Set(actorKey, adminActor)
+		c.Next()
+	}
+}
+
+// bearerMatches checks if the authorization header carries the token, compared in constant time.
+func bearerMatches(header, token string) bool {
+	if token == "" || !strings.HasPrefix(header, bearerPrefix) {
+		return false
+	}
+	informed := strings.TrimPrefix(header, bearerPrefix)
+	return subtle.ConstantTimeCompare([]byte(informed), []byte(token)) == 1
+}
+
+// revealer middleware to allow revealing URLs of protected entries to administrators, the client
+// identity allowed to administer when authenticated by certificates, or the admin token otherwise.
+// Other callers carry on, with URLs concealed.
+func revealer(token func() string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if value, found := c.Get(identityKey); found {
+			identity, ok := value.(*ClientIdentity)
+			c.Set(revealKey, ok && identity.Allows(ActionAdmin))
+		} else {
+			c.Set(revealKey, bearerMatches(c.GetHeader("Authorization"), token()))
+		}
+		c.Next()
+	}
+}
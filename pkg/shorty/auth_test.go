@@ -0,0 +1,39 @@
+package shorty
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAuthAdminAuth(t *testing.T) {
+	tests := []struct {
+		name          string
+		token         string
+		authorization string
+		code          int
+	}{
+		{"disabled", "", "Bearer ", http.StatusForbidden},
+		{"missing", "secret", "", http.StatusUnauthorized},
+		{"invalid", "secret", "Bearer bogus", http.StatusUnauthorized},
+		{"valid", "secret", "Bearer secret", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			router := gin.Default()
+			router.GET("/", adminAuth(tt.token), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			req, err := http.NewRequest("GET", "/", nil)
+			assert.Nil(t, err)
+			req.Header.Set("Authorization", tt.authorization)
+
+			rr := recorderServeHTTP(router, req)
+			assert.Equal(t, tt.code, rr.Code)
+		})
+	}
+}
@@ -0,0 +1,202 @@
+package shorty
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	sqlite3 "github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
+)
+
+// sqliteSidecars suffixes of files SQLite keeps next to the database file, write-ahead log, its
+// shared-memory index and rollback journal, which belong to that database file only.
+var sqliteSidecars = []string{"-wal", "-shm", "-journal"}
+
+// sqliteConn executes function against the underlying SQLite driver connection.
+func sqliteConn(ctx context.Context, db *sql.DB, fn func(*sqlite3.SQLiteConn) error) error {
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn interface{}) error {
+		sqliteConn, ok := driverConn.(*sqlite3.SQLiteConn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection type '%T'", driverConn)
+		}
+		return fn(sqliteConn)
+	})
+}
+
+// Backup copies the database into informed file using SQLite online backup API, therefore it's
+// safe to run while the database is in use. The backup is written in a temporary file, renamed to
+// destination when complete.
+func (p *Persistence) Backup(ctx context.Context, to string) error {
+	tmp := fmt.Sprintf("%s.tmp", to)
+	_ = os.Remove(tmp)
+
+	// backup API requires direct access to driver connections, bypassing instrumentation
+	src, err := sql.Open("sqlite3", p.connStr)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := sql.Open("sqlite3", tmp)
+	if err != nil {
+		return err
+	}
+	defer dst.Close()
+
+	logEntry(ctx).WithField("file", to).Info("Starting database backup")
+	if err = sqliteConn(ctx, dst, func(dstConn *sqlite3.SQLiteConn) error {
+		return sqliteConn(ctx, src, func(srcConn *sqlite3.SQLiteConn) error {
+			backup, err := dstConn.Backup("main", srcConn, "main")
+			if err != nil {
+				return err
+			}
+			// copying all pages in a single step, holding a read lock, for a consistent snapshot
+			if _, err = backup.Step(-1); err != nil {
+				_ = backup.Close()
+				return err
+			}
+			return backup.Finish()
+		})
+	}); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err = dst.Close(); err != nil {
+		return err
+	}
+	if err = os.Rename(tmp, to); err != nil {
+		return err
+	}
+	logEntry(ctx).WithField("file", to).Info("Database backup is written")
+	return nil
+}
+
+// ValidateBackup checks backup file integrity, and if its schema version is known by this version
+// of the application.
+func ValidateBackup(path string) error {
+	if _, err := os.Stat(path); err != nil {
+		return err
+	}
+	// immutable, so backups taken in write-ahead log mode are read without a shared-memory index
+	db, err := sql.Open("sqlite3", fmt.Sprintf("file:%s?mode=ro&immutable=1", path))
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	var integrity string
+	if err = db.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil {
+		return err
+	}
+	if integrity != "ok" {
+		return fmt.Errorf("integrity check failed: '%s'", integrity)
+	}
+
+	var version int
+	if err = db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version < 1 {
+		return fmt.Errorf("backup does not carry a schema version, not a shorty database")
+	}
+	if version > len(migrations) {
+		return fmt.Errorf("backup schema version '%d' is newer than supported '%d'",
+			version, len(migrations))
+	}
+	return nil
+}
+
+// Restore validates the backup file and swaps it with the database file, the current database file
+// is kept with ".before-restore" suffix, along with its sidecar files, so a stale write-ahead log is
+// not replayed on top of the restored database. The application must not be running.
+func Restore(databaseFile, from string) error {
+	if databaseFile == "" {
+		return fmt.Errorf("database-file is not set, can't restore in-memory database")
+	}
+	if err := ValidateBackup(from); err != nil {
+		return fmt.Errorf("invalid backup '%s': %s", from, err)
+	}
+
+	// copying backup next to database file, so the final rename is atomic
+	tmp, err := ioutil.TempFile(filepath.Dir(databaseFile), ".shorty-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	src, err := os.Open(from)
+	if err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	defer src.Close()
+	if _, err = io.Copy(tmp, src); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err = tmp.Close(); err != nil {
+		return err
+	}
+
+	previous := fmt.Sprintf("%s.before-restore", databaseFile)
+	for _, suffix := range append([]string{""}, sqliteSidecars...) {
+		current := databaseFile + suffix
+		if _, err = os.Stat(current); os.IsNotExist(err) {
+			// sidecars of a earlier restore don't belong to the file being kept now
+			if err = os.Remove(previous + suffix); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			continue
+		} else if err != nil {
+			return err
+		}
+		logger.WithField("file", previous+suffix).Info("Keeping current database file")
+		if err = os.Rename(current, previous+suffix); err != nil {
+			return err
+		}
+	}
+	if err = os.Rename(tmp.Name(), databaseFile); err != nil {
+		return err
+	}
+	logger.WithFields(logrus.Fields{"file": databaseFile, "from": from}).Info("Database file is restored")
+	return nil
+}
+
+// Backup streams a online backup of the database as response.
+func (h *Handler) Backup(c *gin.Context) {
+	dir, err := ioutil.TempDir("", "shorty-backup-")
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, h.mapErr(err))
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	name := fmt.Sprintf("shorty-%s.sqlite", time.Now().UTC().Format("20060102T150405Z"))
+	path := filepath.Join(dir, name)
+	if err = h.persistence.Backup(c.Request.Context(), path); err != nil {
+		logEntry(c.Request.Context()).WithError(err).Error("Backup error")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, h.mapErr(err))
+		return
+	}
+
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", name))
+	c.Header("Content-Type", "application/vnd.sqlite3")
+	c.File(path)
+}
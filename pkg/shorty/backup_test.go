@@ -0,0 +1,121 @@
+package shorty
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBackupAndRestore(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-backup.sqlite",
+	}}
+	backupFile := "/var/tmp/shorty-test-backup.sqlite.bkp"
+	_ = os.Remove(config.DatabaseFile)
+	_ = os.Remove(backupFile)
+
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: short, URL: longURL}))
+
+	err = p.Backup(ctx, backupFile)
+	assert.Nil(t, err)
+	assert.Nil(t, ValidateBackup(backupFile))
+
+	t.Log("Changes after backup must be gone after restore")
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: "after", URL: longURL}))
+	p.Close()
+
+	assert.Nil(t, Restore(config.DatabaseFile, backupFile))
+	_, err = os.Stat(config.DatabaseFile + ".before-restore")
+	assert.Nil(t, err)
+
+	p, err = NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	_, err = p.Read(ctx, short)
+	assert.Nil(t, err)
+	_, err = p.Read(ctx, "after")
+	assert.True(t, p.IsErrNoRows(err))
+}
+
+func TestBackupRestoreWithStaleWAL(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-backup-wal.sqlite",
+		SQLiteFlags:  "_journal_mode=WAL",
+	}}
+	backupFile := "/var/tmp/shorty-test-backup-wal.sqlite.bkp"
+	for _, suffix := range append([]string{"", ".before-restore"}, sqliteSidecars...) {
+		_ = os.Remove(config.DatabaseFile + suffix)
+	}
+	_ = os.Remove(backupFile)
+
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: short, URL: longURL}))
+	assert.Nil(t, p.Backup(ctx, backupFile))
+
+	t.Log("Write-ahead log carrying changes after backup is left behind, as after a crash")
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: "after", URL: longURL}))
+	wal, err := ioutil.ReadFile(config.DatabaseFile + "-wal")
+	assert.Nil(t, err)
+	assert.NotEmpty(t, wal)
+	p.Close()
+	assert.Nil(t, ioutil.WriteFile(config.DatabaseFile+"-wal", wal, 0644))
+
+	assert.Nil(t, Restore(config.DatabaseFile, backupFile))
+	_, err = os.Stat(config.DatabaseFile + "-wal")
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(config.DatabaseFile + ".before-restore-wal")
+	assert.Nil(t, err)
+
+	p, err = NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	_, err = p.Read(ctx, short)
+	assert.Nil(t, err)
+	_, err = p.Read(ctx, "after")
+	assert.True(t, p.IsErrNoRows(err))
+}
+
+func TestBackupValidateBackup(t *testing.T) {
+	assert.Error(t, ValidateBackup("/var/tmp/shorty-test-does-not-exist.sqlite"))
+
+	bogus := "/var/tmp/shorty-test-bogus.sqlite"
+	assert.Nil(t, ioutil.WriteFile(bogus, []byte("bogus"), 0644))
+	defer os.Remove(bogus)
+	assert.Error(t, ValidateBackup(bogus))
+	assert.Error(t, Restore("/var/tmp/shorty-test-restore.sqlite", bogus))
+
+	assert.Error(t, Restore("", bogus))
+}
+
+func TestBackupHandler(t *testing.T) {
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-backup-handler.sqlite",
+	}}
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	router := gin.Default()
+	router.POST("/admin/backup", NewHandler(p).Backup)
+
+	req, err := http.NewRequest("POST", "/admin/backup", nil)
+	assert.Nil(t, err)
+
+	rr := recorderServeHTTP(router, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Result().Header.Get("Content-Disposition"), "attachment")
+	assert.Equal(t, "SQLite format 3\x00", rr.Body.String()[:16])
+}
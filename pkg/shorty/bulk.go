@@ -0,0 +1,167 @@
+package shorty
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// bulkChunkSize amount of entries stored per transaction.
+	bulkChunkSize = 500
+	// ndjsonContentType content-type for new-line delimited JSON payloads.
+	ndjsonContentType = "application/x-ndjson"
+)
+
+// Outcomes for a bulk item.
+const (
+	BulkCreated  = "created"
+	BulkConflict = "conflict"
+	BulkInvalid  = "invalid"
+	BulkError    = "error"
+)
+
+// BulkResult represents the outcome of a single bulk item.
+type BulkResult struct {
+	Index  int    `json:"index"`           // position in the payload
+	Short  string `json:"short,omitempty"` // short string informed
+	Status string `json:"status"`          // created, conflict, invalid or error
+	Msg    string `json:"msg,omitempty"`   // error message
+}
+
+// BulkResponse summary and per-item results of a bulk request.
+type BulkResponse struct {
+	Created  int           `json:"created"`  // amount of created entries
+	Conflict int           `json:"conflict"` // amount of entries already existing
+	Invalid  int           `json:"invalid"`  // amount of entries not passing validation
+	Error    int           `json:"error"`    // amount of entries failing for other reasons
+	Results  []*BulkResult `json:"results"`  // per-item results, in payload order
+}
+
+// add register a result, and account its status on summary.
+func (b *BulkResponse) add(result *BulkResult) {
+	switch result.Status {
+	case BulkCreated:
+		b.Created++
+	case BulkConflict:
+		b.Conflict++
+	case BulkInvalid:
+		b.Invalid++
+	default:
+		b.Error++
+	}
+	b.Results = append(b.Results, result)
+}
+
+// Bulk creates entries informed as a JSON array, or NDJSON stream, of short and URL pairs. Entries
+// are stored in chunks, and the outcome of each item is reported without failing the whole batch.
+// When storing a chunk fails, its items and the ones not processed yet are reported as error, while
+// earlier chunks are kept. Entries are decoded as on create, so password hashes can't be informed.
+func (h *Handler) Bulk(c *gin.Context) {
+	response := &BulkResponse{Results: []*BulkResult{}}
+	dec := &jsonDecoder{
+		dec:   json.NewDecoder(c.Request.Body),
+		array: c.ContentType() != ndjsonContentType,
+	}
+
+	chunk := []*Shortened{}
+	indexes := []int{}
+	var failure error // storage failure, items after it are not processed
+	flush := func() {
+		if len(chunk) == 0 {
+			return
+		}
+		errs, err := h.persistence.WriteBulk(h.actorContext(c), chunk)
+		if err != nil {
+			logEntry(c.Request.Context()).WithError(err).Error("Persistence error")
+			failure = err
+		}
+		for i, s := range chunk {
+			var result *BulkResult
+			if err != nil {
+				result = &BulkResult{Index: indexes[i], Short: s.Short, Status: BulkError,
+					Msg: err.Error()}
+			} else {
+				result = h.bulkResult(indexes[i], s.Short, errs[i])
+			}
+			h.metrics.created(c.Request.Context(), result.Status)
+			response.add(result)
+		}
+		chunk = []*Shortened{}
+		indexes = []int{}
+	}
+
+	for i := 0; ; i++ {
+		var shortened Shortened
+		err := dec.Decode(&shortened)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			// decoder can't recover from malformed payload, stopping here
+			response.add(&BulkResult{Index: i, Status: BulkInvalid, Msg: fmt.Sprintf(
+				"malformed payload, stopped processing: %s", err)})
+			break
+		}
+
+		if failure != nil {
+			h.metrics.created(c.Request.Context(), outcomeError)
+			response.add(&BulkResult{Index: i, Short: shortened.Short, Status: BulkError,
+				Msg: fmt.Sprintf("not processed, storing a earlier chunk failed: %s", failure)})
+			continue
+		}
+		if err = h.validate(c.Request, &shortened); err == nil {
+			err = shortened.hashPassword()
+		}
+		if err != nil {
+			h.metrics.rejected(c.Request.Context(), err)
+			h.metrics.created(c.Request.Context(), outcomeInvalid)
+			response.add(&BulkResult{
+				Index: i, Short: shortened.Short, Status: BulkInvalid, Msg: err.Error()})
+			continue
+		}
+
+		shortened.CreatedAt = time.Now().Unix()
+		shortened.Clicks = 0
+		chunk = append(chunk, &shortened)
+		indexes = append(indexes, i)
+		if len(chunk) >= h.bulkChunkSize {
+			flush()
+		}
+	}
+	flush()
+
+	// invalid items are reported before the chunk they belong to is stored
+	sort.Slice(response.Results, func(i, j int) bool {
+		return response.Results[i].Index < response.Results[j].Index
+	})
+
+	logEntry(c.Request.Context()).WithFields(logrus.Fields{
+		"created":  response.Created,
+		"conflict": response.Conflict,
+		"invalid":  response.Invalid,
+		"error":    response.Error,
+	}).Info("Bulk request is processed")
+	c.JSON(http.StatusOK, response)
+}
+
+// bulkResult translate the persistence error into a item result.
+func (h *Handler) bulkResult(index int, short string, err error) *BulkResult {
+	result := &BulkResult{Index: index, Short: short, Status: BulkCreated}
+	if err == nil {
+		return result
+	}
+	result.Msg = err.Error()
+	if h.persistence.IsErrUniqueConstraint(err) {
+		result.Status = BulkConflict
+	} else {
+		result.Status = BulkError
+	}
+	return result
+}
@@ -0,0 +1,135 @@
+package shorty
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// bulkRequest posts the payload on bulk endpoint, returning the parsed response.
+func bulkRequest(t *testing.T, h *Handler, contentType, payload string) (int, *BulkResponse) {
+	router := gin.Default()
+	router.POST("/_bulk", h.Bulk)
+
+	req, err := http.NewRequest("POST", "/_bulk", strings.NewReader(payload))
+	assert.Nil(t, err)
+	req.Header.Set("Content-Type", contentType)
+
+	rr := recorderServeHTTP(router, req)
+
+	response := &BulkResponse{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), response))
+	return rr.Code, response
+}
+
+func TestBulk(t *testing.T) {
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-bulk.sqlite",
+	}}
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	h := NewHandler(p)
+
+	t.Run("json-array", func(t *testing.T) {
+		payload := `[
+			{"short": "a", "url": "http://a.com"},
+			{"short": "b", "url": "http://b.com"},
+			{"short": "a", "url": "http://a.com"},
+			{"short": "_c", "url": "http://c.com"},
+			{"short": "d", "url": ""}
+		]`
+		code, response := bulkRequest(t, h, "application/json", payload)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 2, response.Created)
+		assert.Equal(t, 1, response.Conflict)
+		assert.Equal(t, 2, response.Invalid)
+		assert.Len(t, response.Results, 5)
+		assert.Equal(t, 2, response.Results[2].Index)
+		assert.Equal(t, BulkConflict, response.Results[2].Status)
+	})
+
+	t.Run("ndjson", func(t *testing.T) {
+		payload := `{"short": "e", "url": "http://e.com"}
+{"short": "b", "url": "http://b.com"}
+`
+		code, response := bulkRequest(t, h, ndjsonContentType, payload)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 1, response.Created)
+		assert.Equal(t, 1, response.Conflict)
+	})
+
+	t.Run("malformed", func(t *testing.T) {
+		payload := `[{"short": "f", "url": "http://f.com"}, bogus]`
+		code, response := bulkRequest(t, h, "application/json", payload)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 1, response.Created)
+		assert.Equal(t, 1, response.Invalid)
+		assert.Equal(t, BulkInvalid, response.Results[1].Status)
+	})
+
+	t.Run("password-hash", func(t *testing.T) {
+		payload := `[{"short": "g", "url": "http://g.com", "password_hash": "garbage"}]`
+		code, response := bulkRequest(t, h, "application/json", payload)
+
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 1, response.Created)
+	})
+
+	t.Run("chunk-failure", func(t *testing.T) {
+		h.bulkChunkSize = 2
+		defer func() { h.bulkChunkSize = bulkChunkSize }()
+		_, err := p.db.Exec(`CREATE TRIGGER fail_bulk BEFORE INSERT ON audit WHEN NEW.short = 'k'
+			BEGIN SELECT RAISE(ABORT, 'injected failure'); END`)
+		assert.Nil(t, err)
+		defer func() { _, _ = p.db.Exec("DROP TRIGGER fail_bulk") }()
+
+		payload := `[
+			{"short": "h", "url": "http://h.com"},
+			{"short": "i", "url": "http://i.com"},
+			{"short": "j", "url": "http://j.com"},
+			{"short": "k", "url": "http://k.com"},
+			{"short": "l", "url": "http://l.com"}
+		]`
+		code, response := bulkRequest(t, h, "application/json", payload)
+
+		t.Log("Items stored before the failing chunk must be reported as created")
+		assert.Equal(t, http.StatusOK, code)
+		assert.Equal(t, 2, response.Created)
+		assert.Equal(t, 3, response.Error)
+		assert.Len(t, response.Results, 5)
+		for i, status := range []string{BulkCreated, BulkCreated, BulkError, BulkError, BulkError} {
+			assert.Equal(t, i, response.Results[i].Index)
+			assert.Equal(t, status, response.Results[i].Status)
+		}
+		assert.Contains(t, response.Results[3].Msg, "injected failure")
+		assert.Contains(t, response.Results[4].Msg, "not processed")
+
+		shortened, err := p.Read(context.Background(), "i")
+		assert.Nil(t, err)
+		assert.Equal(t, "http://i.com", shortened.URL)
+		_, err = p.Read(context.Background(), "j")
+		assert.Equal(t, sql.ErrNoRows, err)
+	})
+
+	shortened, err := p.Read(context.Background(), "f")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://f.com", shortened.URL)
+
+	t.Log("Password hash must not be taken from bulk payload")
+	shortened, err = p.Read(context.Background(), "g")
+	assert.Nil(t, err)
+	assert.False(t, shortened.Protected)
+	assert.Empty(t, shortened.PasswordHash)
+}
@@ -0,0 +1,50 @@
+package shorty
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validateMaxClicks check if maximum clicks is not negative, zero is unlimited.
+func validateMaxClicks(maxClicks int64) error {
+	if maxClicks < 0 {
+		return reject(rejectMaxClicks, "max_clicks can't be negative, use zero for unlimited")
+	}
+	return nil
+}
+
+// click accounts a click on the entry limited by maximum clicks. When no clicks are left, as when
+// used up by concurrent requests, responds as gone and returns false.
+func (h *Handler) click(c *gin.Context, shortened *Shortened) bool {
+	ctx := c.Request.Context()
+	clickCtx, span := startSpan(ctx, "shorty.persistence.click",
+		spanShortKey.String(shortened.Short), spanBackendKey.String(storageBackend))
+	err := h.persistence.Click(clickCtx, shortened.Short)
+	exhausted := h.persistence.IsErrNoRows(err)
+	if exhausted {
+		err = nil
+	}
+	endSpan(span, err)
+	if err != nil {
+		annotateSpan(ctx, shortened.Short, outcomeError)
+		logEntry(ctx).WithField("short", shortened.Short).WithError(err).Error("Persistence error")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, h.mapErr(err))
+		return false
+	}
+	if exhausted {
+		h.exhausted(c, shortened.Short)
+		return false
+	}
+	shortened.Clicks++
+	return true
+}
+
+// exhausted responds as gone, for entries without clicks left.
+func (h *Handler) exhausted(c *gin.Context, short string) {
+	ctx := c.Request.Context()
+	h.metrics.missed(ctx, missExhausted)
+	annotateSpan(ctx, short, missExhausted)
+	logEntry(ctx).WithField("short", short).Debug("Short string has no clicks left")
+	c.AbortWithStatusJSON(http.StatusGone, gin.H{"msg": "short link has reached its maximum clicks"})
+}
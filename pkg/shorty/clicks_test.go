@@ -0,0 +1,100 @@
+package shorty
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestClicksPersistence(t *testing.T) {
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-clicks.sqlite"
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	ctx := context.Background()
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: short, URL: longURL, MaxClicks: 3}))
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: "unlimited", URL: longURL}))
+
+	t.Log("Concurrent clicks must not exceed the limit")
+	var wg sync.WaitGroup
+	var m sync.Mutex
+	clicked := 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := p.Click(ctx, short)
+			if err != nil {
+				assert.True(t, p.IsErrNoRows(err))
+				return
+			}
+			m.Lock()
+			clicked++
+			m.Unlock()
+		}()
+	}
+	wg.Wait()
+	assert.Equal(t, 3, clicked)
+
+	shortened, err := p.Read(ctx, short)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(3), shortened.MaxClicks)
+	assert.Equal(t, int64(3), shortened.Clicks)
+
+	assert.True(t, p.IsErrNoRows(p.Click(ctx, "unlimited")))
+	assert.True(t, p.IsErrNoRows(p.Click(ctx, "missing")))
+}
+
+func TestClicksHandler(t *testing.T) {
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-clicks-handler.sqlite"
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	router := gin.New()
+	h := NewHandler(p)
+	router.POST("/shorty/:short", h.Create)
+	router.GET("/shorty/:short", h.Read)
+	create := func(body string) int {
+		req := httptest.NewRequest("POST", "/shorty/"+short, strings.NewReader(body))
+		return recorderServeHTTP(router, req).Code
+	}
+	get := func(path string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", "application/json")
+		return recorderServeHTTP(router, req)
+	}
+
+	assert.Equal(t, http.StatusBadRequest, create(`{"url":"http://x.y.z","max_clicks":-1}`))
+	assert.Equal(t, http.StatusCreated, create(`{"url":"http://x.y.z","max_clicks":2,"clicks":5}`))
+
+	t.Log("Preview must not account clicks")
+	assert.Equal(t, http.StatusOK, get("/shorty/abc+").Code)
+	assert.Equal(t, http.StatusOK, get("/shorty/abc+").Code)
+
+	t.Log("Redirects account clicks, until exhausted")
+	rr := get("/shorty/abc")
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"clicks":1`)
+	rr = get("/shorty/abc")
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"clicks":2`)
+
+	t.Log("Exhausted links are gone, preview included")
+	assert.Equal(t, http.StatusGone, get("/shorty/abc+").Code)
+	rr = get("/shorty/abc")
+	assert.Equal(t, http.StatusGone, rr.Code)
+	assert.Empty(t, rr.Header().Get("Location"))
+	assert.NotContains(t, rr.Body.String(), longURL)
+}
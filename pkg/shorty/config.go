@@ -1,42 +1,262 @@
 package shorty
 
-import "fmt"
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+)
 
-// Config primary application configuration
+// ServerConfig listeners, TLS and HTTP server settings.
+type ServerConfig struct {
+	Address            string `mapstructure:"address"`              // listen address, split by colon
+	SocketMode         string `mapstructure:"socket-mode"`          // unix socket permissions, octal
+	TLSCert            string `mapstructure:"tls-cert"`             // TLS certificate file path
+	TLSKey             string `mapstructure:"tls-key"`              // TLS private key file path
+	TLSRedirectAddress string `mapstructure:"tls-redirect-address"` // plain HTTP, redirects to HTTPS
+	AdminAddress       string `mapstructure:"admin-address"`        // admin and management address
+	PublicURL          string `mapstructure:"public-url"`           // base URL of short links
+	WriteTimeout       int    `mapstructure:"write-timeout"`        // write timeout in seconds
+	ReadTimeout        int    `mapstructure:"read-timeout"`         // read timeout in seconds
+	IdleTimeout        int    `mapstructure:"idle-timeout"`         // idle timeout in seconds
+	ShutdownTimeout    int    `mapstructure:"shutdown-timeout"`     // graceful shutdown, in seconds
+	ShutdownDelay      int    `mapstructure:"shutdown-delay"`       // seconds failing readiness
+}
+
+// StorageConfig database settings.
+type StorageConfig struct {
+	DatabaseFile    string `mapstructure:"database-file"`    // path to database file (sqlite)
+	SQLiteFlags     string `mapstructure:"sqlite-flags"`     // used in combination with database-file
+	CaseInsensitive bool   `mapstructure:"case-insensitive"` // compare short strings without case
+	TrashRetention  int    `mapstructure:"trash-retention"`  // hours to keep deleted, zero is forever
+}
+
+// SecurityConfig authentication and authorization settings.
+type SecurityConfig struct {
+	AdminToken    string `mapstructure:"admin-token"`     // bearer token, empty disables admin
+	AdminClientCA string `mapstructure:"admin-client-ca"` // CA bundle to require client certs
+	// PasswordMaxAttempts failed password attempts per protected link, before locking it
+	PasswordMaxAttempts int `mapstructure:"password-max-attempts"`
+	// PasswordLockout seconds failed password attempts are accounted for, and a link stays locked
+	PasswordLockout int `mapstructure:"password-lockout"`
+	// ClientIdentities maps client certificate subject common-names to identities
+	ClientIdentities map[string]*ClientIdentity `mapstructure:"client-identities"`
+}
+
+// LoggingConfig log level and output format, and access log settings.
+type LoggingConfig struct {
+	LogLevel             string  `mapstructure:"log-level"`               // trace, debug, info, etc
+	LogFormat            string  `mapstructure:"log-format"`              // text or json
+	AccessLogFormat      string  `mapstructure:"access-log-format"`       // combined, json or off
+	AccessLogFile        string  `mapstructure:"access-log-file"`         // empty for standard output
+	AccessLogMaxSize     int     `mapstructure:"access-log-max-size"`     // megabytes before rotating
+	AccessLogMaxBackups  int     `mapstructure:"access-log-max-backups"`  // rotated files to keep
+	AccessLogSampleRate  float64 `mapstructure:"access-log-sample-rate"`  // ratio of redirects logged
+	AccessLogRedactQuery bool    `mapstructure:"access-log-redact-query"` // redact query values
+}
+
+// TelemetryConfig tracing export settings, metrics are always served on "/metrics".
+type TelemetryConfig struct {
+	OTLPEndpoint    string  `mapstructure:"otlp-endpoint"`     // OTLP/HTTP collector, empty disables
+	OTLPInsecure    bool    `mapstructure:"otlp-insecure"`     // plain HTTP to the collector
+	ServiceName     string  `mapstructure:"service-name"`      // service name in traces
+	TraceSampleRate float64 `mapstructure:"trace-sample-rate"` // ratio of traces started here
+}
+
+// Config primary application configuration, organized in sections. Section fields are promoted, so
+// they can be accessed directly, as in "config.Address".
 type Config struct {
-	Address      string // listen address and port, split by colon
-	WriteTimeout int    // write timeout in seconds
-	ReadTimeout  int    // read timeout in seconds
-	IdleTimeout  int    // idle timeout in seconds
-	DatabaseFile string // path to database file (sqlite)
-	SQLiteFlags  string // to be used in combination with database-file
+	ServerConfig    `mapstructure:"server"`
+	StorageConfig   `mapstructure:"storage"`
+	SecurityConfig  `mapstructure:"security"`
+	LoggingConfig   `mapstructure:"logging"`
+	TelemetryConfig `mapstructure:"telemetry"`
+}
+
+// ValidationError aggregates all errors found when validating the configuration.
+type ValidationError struct {
+	Errs []error // errors found, in order of fields
+}
+
+// Error joins all error messages.
+func (v *ValidationError) Error() string {
+	messages := []string{}
+	for _, err := range v.Errs {
+		messages = append(messages, err.Error())
+	}
+	return fmt.Sprintf("invalid configuration: %s", strings.Join(messages, "; "))
+}
+
+// validateAddress checks TCP addresses, unix domain sockets and systemd inherited listeners.
+func validateAddress(name, address string) error {
+	switch {
+	case strings.HasPrefix(address, systemdPrefix):
+		return nil
+	case strings.HasPrefix(address, unixPrefix):
+		if address == unixPrefix {
+			return fmt.Errorf("%s requires a socket path, as in 'unix:/run/shorty.sock'", name)
+		}
+		return nil
+	}
+	if _, _, err := net.SplitHostPort(address); err != nil {
+		return fmt.Errorf("invalid value for %s: '%s'", name, address)
+	}
+	return nil
 }
 
-// Validate config contents.
+// Validate config contents, all errors found are returned as ValidationError.
 func (c *Config) Validate() error {
+	errs := []error{}
+	check := func(failed bool, format string, a ...interface{}) {
+		if failed {
+			errs = append(errs, fmt.Errorf(format, a...))
+		}
+	}
+
+	// server
 	if c.Address == "" {
-		return fmt.Errorf("address is empty: '%s'", c.Address)
+		errs = append(errs, fmt.Errorf("address is empty"))
+	} else if err := validateAddress("address", c.Address); err != nil {
+		errs = append(errs, err)
+	}
+	for _, optional := range [][2]string{
+		{"admin-address", c.AdminAddress},
+		{"tls-redirect-address", c.TLSRedirectAddress},
+	} {
+		if optional[1] == "" {
+			continue
+		}
+		if err := validateAddress(optional[0], optional[1]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if c.SocketMode != "" {
+		if _, err := parseSocketMode(c.SocketMode); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	check((c.TLSCert == "") != (c.TLSKey == ""), "tls-cert and tls-key must be informed together")
+	check(c.TLSRedirectAddress != "" && c.TLSCert == "",
+		"tls-redirect-address requires tls-cert and tls-key")
+	if c.PublicURL != "" {
+		parsed, err := url.Parse(c.PublicURL)
+		check(err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") ||
+			parsed.Host == "" || parsed.RawQuery != "" || parsed.Fragment != "",
+			"invalid value for public-url: '%s'", c.PublicURL)
+	}
+	// short URLs, on QR codes and web UI, would be based on the admin listener otherwise
+	check(c.AdminAddress != "" && c.PublicURL == "", "admin-address requires public-url")
+	check(c.WriteTimeout <= 0, "invalid value for write-timeout: '%d'", c.WriteTimeout)
+	check(c.ReadTimeout <= 0, "invalid value for read-timeout: '%d'", c.ReadTimeout)
+	check(c.IdleTimeout <= 0, "invalid value for idle-timeout: '%d'", c.IdleTimeout)
+	check(c.ShutdownTimeout < 0, "invalid value for shutdown-timeout: '%d'", c.ShutdownTimeout)
+	check(c.ShutdownDelay < 0, "invalid value for shutdown-delay: '%d'", c.ShutdownDelay)
+
+	// storage
+	if _, err := url.ParseQuery(c.SQLiteFlags); err != nil {
+		errs = append(errs, fmt.Errorf("invalid value for sqlite-flags: '%s'", err))
 	}
-	if c.WriteTimeout <= 0 {
-		return fmt.Errorf("invalid value for write-timeout: '%d'", c.WriteTimeout)
+	check(c.TrashRetention < 0, "invalid value for trash-retention: '%d'", c.TrashRetention)
+
+	// security
+	check(strings.ContainsAny(c.AdminToken, " \t\r\n"), "admin-token must not contain whitespace")
+	check(c.AdminClientCA != "" && (c.AdminAddress == "" || c.TLSCert == ""),
+		"admin-client-ca requires admin-address, tls-cert and tls-key")
+	check(len(c.ClientIdentities) > 0 && c.AdminClientCA == "",
+		"client-identities requires admin-client-ca")
+	check(c.PasswordMaxAttempts <= 0,
+		"invalid value for password-max-attempts: '%d'", c.PasswordMaxAttempts)
+	check(c.PasswordLockout <= 0, "invalid value for password-lockout: '%d'", c.PasswordLockout)
+	for commonName, identity := range c.ClientIdentities {
+		if identity == nil || identity.Name == "" {
+			errs = append(errs, fmt.Errorf("empty identity name for common-name '%s'", commonName))
+			continue
+		}
+		for _, action := range identity.Actions {
+			check(!isAction(action), "invalid action '%s' for common-name '%s'", action, commonName)
+		}
+	}
+
+	// logging
+	if _, err := parseLogLevel(c.LogLevel); err != nil {
+		errs = append(errs, err)
 	}
-	if c.ReadTimeout <= 0 {
-		return fmt.Errorf("invalid value for read-timeout: '%d'", c.ReadTimeout)
+	if _, err := newLogFormatter(c.LogFormat); err != nil {
+		errs = append(errs, err)
 	}
-	if c.IdleTimeout <= 0 {
-		return fmt.Errorf("invalid value for idle-timeout: '%d'", c.IdleTimeout)
+	switch c.AccessLogFormat {
+	case "", AccessLogCombined, AccessLogJSON, AccessLogOff:
+	default:
+		errs = append(errs, fmt.Errorf("invalid value for access-log-format: '%s'", c.AccessLogFormat))
+	}
+	check(c.AccessLogMaxSize < 0, "invalid value for access-log-max-size: '%d'", c.AccessLogMaxSize)
+	check(c.AccessLogMaxBackups < 0,
+		"invalid value for access-log-max-backups: '%d'", c.AccessLogMaxBackups)
+	check(c.AccessLogSampleRate < 0 || c.AccessLogSampleRate > 1,
+		"invalid value for access-log-sample-rate: '%v'", c.AccessLogSampleRate)
+	check(c.AccessLogSampleRate == 0, "access-log-sample-rate must be greater than zero, "+
+		"to disable the access log use access-log-format 'off'")
+
+	// telemetry
+	if c.OTLPEndpoint != "" {
+		_, _, err := net.SplitHostPort(c.OTLPEndpoint)
+		check(err != nil, "invalid value for otlp-endpoint: '%s'", c.OTLPEndpoint)
+	}
+	check(c.ServiceName == "", "service-name is empty")
+	check(c.TraceSampleRate < 0 || c.TraceSampleRate > 1,
+		"invalid value for trace-sample-rate: '%v'", c.TraceSampleRate)
+
+	if len(errs) > 0 {
+		return &ValidationError{Errs: errs}
 	}
 	return nil
 }
 
+// reload copies settings which are safe to change at runtime from the informed configuration.
+func (c *Config) reload(from *Config) {
+	c.ShutdownTimeout = from.ShutdownTimeout
+	c.ShutdownDelay = from.ShutdownDelay
+	c.TrashRetention = from.TrashRetention
+	c.AdminToken = from.AdminToken
+	c.ClientIdentities = from.ClientIdentities
+	c.PasswordMaxAttempts = from.PasswordMaxAttempts
+	c.PasswordLockout = from.PasswordLockout
+	c.LogLevel = from.LogLevel
+	c.LogFormat = from.LogFormat
+}
+
 // NewConfig with default values.
 func NewConfig() *Config {
 	return &Config{
-		Address:      "127.0.0.1:8000",
-		WriteTimeout: 30,
-		ReadTimeout:  10,
-		IdleTimeout:  60,
-		DatabaseFile: "",
-		SQLiteFlags:  "_busy_timeout=5000&cache=shared&mode=rwc",
+		ServerConfig: ServerConfig{
+			Address:         "127.0.0.1:8000",
+			SocketMode:      defaultSocketMode,
+			WriteTimeout:    30,
+			ReadTimeout:     10,
+			IdleTimeout:     60,
+			ShutdownTimeout: 20,
+		},
+		StorageConfig: StorageConfig{
+			DatabaseFile:   "",
+			SQLiteFlags:    "_busy_timeout=5000&cache=shared&mode=rwc",
+			TrashRetention: 720,
+		},
+		SecurityConfig: SecurityConfig{
+			PasswordMaxAttempts: defaultPasswordMaxAttempts,
+			PasswordLockout:     defaultPasswordLockout,
+		},
+		LoggingConfig: LoggingConfig{
+			LogLevel:             defaultLogLevel,
+			LogFormat:            LogFormatText,
+			AccessLogFormat:      AccessLogCombined,
+			AccessLogMaxSize:     100,
+			AccessLogMaxBackups:  5,
+			AccessLogSampleRate:  1,
+			AccessLogRedactQuery: true,
+		},
+		TelemetryConfig: TelemetryConfig{
+			ServiceName:     "shorty",
+			TraceSampleRate: 1,
+		},
 	}
 }
@@ -20,3 +20,101 @@ func TestConfigValidate(t *testing.T) {
 	err = config.Validate()
 	assert.NotNil(t, err)
 }
+
+func TestConfigValidateTLS(t *testing.T) {
+	c := NewConfig()
+	c.TLSCert = "/path/to/cert"
+	assert.NotNil(t, c.Validate())
+
+	c.TLSKey = "/path/to/key"
+	assert.Nil(t, c.Validate())
+
+	c.TLSRedirectAddress = "127.0.0.1:8080"
+	assert.Nil(t, c.Validate())
+
+	c.TLSCert, c.TLSKey = "", ""
+	assert.NotNil(t, c.Validate())
+}
+
+func TestConfigValidateAdminAddress(t *testing.T) {
+	c := NewConfig()
+	c.AdminAddress = "127.0.0.1:8443"
+	assert.NotNil(t, c.Validate())
+
+	t.Log("Short URLs must not be based on the admin listener address")
+	c.PublicURL = "https://sho.rt"
+	assert.Nil(t, c.Validate())
+
+	c.ClientIdentities = map[string]*ClientIdentity{"cn": {Name: "identity"}}
+	assert.NotNil(t, c.Validate())
+
+	c.AdminClientCA = "/path/to/ca"
+	assert.NotNil(t, c.Validate())
+
+	c.TLSCert, c.TLSKey = "/path/to/cert", "/path/to/key"
+	assert.Nil(t, c.Validate())
+
+	c.AdminAddress = ""
+	assert.NotNil(t, c.Validate())
+}
+
+func TestConfigValidatePublicURL(t *testing.T) {
+	c := NewConfig()
+	for _, valid := range []string{"https://sho.rt", "http://127.0.0.1:8000/", "https://x.y/prefix"} {
+		c.PublicURL = valid
+		assert.Nil(t, c.Validate(), valid)
+	}
+	for _, invalid := range []string{"sho.rt", "ftp://sho.rt", "https://", "https://sho.rt/?q=1"} {
+		c.PublicURL = invalid
+		assert.NotNil(t, c.Validate(), invalid)
+	}
+}
+
+func TestConfigValidateTelemetry(t *testing.T) {
+	c := NewConfig()
+	c.OTLPEndpoint = "127.0.0.1:4318"
+	assert.Nil(t, c.Validate())
+
+	c.OTLPEndpoint = "http://127.0.0.1:4318/v1/traces"
+	assert.NotNil(t, c.Validate())
+
+	c.OTLPEndpoint, c.ServiceName = "", ""
+	assert.NotNil(t, c.Validate())
+
+	c = NewConfig()
+	c.TraceSampleRate = 1.5
+	assert.NotNil(t, c.Validate())
+}
+
+func TestConfigValidateAccessLog(t *testing.T) {
+	c := NewConfig()
+	c.AccessLogSampleRate = 0.1
+	assert.Nil(t, c.Validate())
+
+	c.AccessLogSampleRate = 0
+	err := c.Validate()
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "access-log-format 'off'")
+
+	c.AccessLogSampleRate = 1.5
+	assert.NotNil(t, c.Validate())
+}
+
+func TestConfigValidateAggregated(t *testing.T) {
+	c := NewConfig()
+	c.Address = "bogus"
+	c.WriteTimeout = 0
+	c.SQLiteFlags = "%"
+	c.AdminToken = "with space"
+	c.ClientIdentities = map[string]*ClientIdentity{"cn": {Name: "identity", Actions: []string{"bogus"}}}
+	c.LogLevel = "bogus"
+	c.AccessLogSampleRate = 2
+
+	err := c.Validate()
+	assert.NotNil(t, err)
+	validationErr, ok := err.(*ValidationError)
+	assert.True(t, ok)
+	assert.Len(t, validationErr.Errs, 8)
+	assert.Contains(t, err.Error(), "invalid value for address: 'bogus'")
+	assert.Contains(t, err.Error(), "invalid action 'bogus' for common-name 'cn'")
+}
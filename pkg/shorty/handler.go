@@ -1,18 +1,62 @@
 package shorty
 
 import (
+	"context"
 	"fmt"
-	"log"
 	"net/http"
 	"net/url"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+const (
+	// reservedPrefix short strings starting with this prefix are reserved for application endpoints.
+	reservedPrefix = "_"
+	// maxPageSize maximum amount of entries in a page of listing.
+	maxPageSize = 1000
+)
+
+// Validation rejection reasons.
+const (
+	rejectMalformed     = "malformed"
+	rejectEmptyShort    = "empty_short"
+	rejectReservedShort = "reserved_short"
+	rejectSlashShort    = "slash_short"
+	rejectPreviewShort  = "preview_short"
+	rejectLongPassword  = "long_password"
+	rejectMaxClicks     = "invalid_max_clicks"
+	rejectEmptyURL      = "empty_url"
+	rejectInvalidURL    = "invalid_url"
+	rejectSameHost      = "same_host"
+	rejectLocalhost     = "localhost"
+)
+
+// rejection validation error, carrying the reason of rejection.
+type rejection struct {
+	reason string // rejection reason
+	msg    string // error message
+}
+
+// Error returns the error message.
+func (r *rejection) Error() string {
+	return r.msg
+}
+
+// reject creates a validation error for the reason, formatting the message.
+func reject(reason, format string, a ...interface{}) error {
+	return &rejection{reason: reason, msg: fmt.Sprintf(format, a...)}
+}
+
 // Handler http endpoint handlers.
 type Handler struct {
-	persistence *Persistence // persistence instance
+	persistence *Persistence    // persistence instance
+	metrics     *linkMetrics    // redirects, creates and rejections
+	attempts    *attemptLimiter // password attempts on protected entries
+	// bulkChunkSize amount of bulk entries stored per transaction
+	bulkChunkSize int
 }
 
 // Slash or root, just shows the app name.
@@ -30,34 +74,68 @@ func (h *Handler) Create(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, fmt.Errorf("short is not found as sub-path"))
 		return
 	}
+	ctx := c.Request.Context()
 	if err = c.ShouldBindJSON(&shortened); err != nil {
+		h.metrics.rejected(ctx, err)
+		h.createOutcome(ctx, short, outcomeInvalid)
 		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, h.mapErr(err))
 		return
 	}
-	if err = h.validateURL(c.Request, shortened.URL); err != nil {
+
+	shortened.Short = short
+	_, span := startSpan(ctx, "shorty.validate", spanShortKey.String(short))
+	err = h.validate(c.Request, &shortened)
+	endSpan(span, err)
+	if err != nil {
+		h.metrics.rejected(ctx, err)
+		h.createOutcome(ctx, short, outcomeInvalid)
 		c.AbortWithStatusJSON(http.StatusBadRequest, h.mapErr(err))
 		return
 	}
 
-	shortened.Short = short
 	shortened.CreatedAt = time.Now().Unix()
+	shortened.Clicks = 0
+	if err = shortened.hashPassword(); err != nil {
+		h.createOutcome(ctx, short, outcomeError)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, h.mapErr(err))
+		return
+	}
 
-	log.Printf("Saving short string '%s' for URL '%s'", shortened.Short, shortened.URL)
-	if err = h.persistence.Write(c.Request.Context(), &shortened); err != nil {
-		status := http.StatusInternalServerError
-		log.Printf("Persistence error: '%s'", err)
+	entry := logEntry(ctx).WithField("short", shortened.Short)
+	entry.WithField("url", shortened.URL).Debug("Saving short string")
+	writeCtx, span := startSpan(h.actorContext(c), "shorty.persistence.write",
+		spanShortKey.String(short), spanBackendKey.String(storageBackend))
+	err = h.persistence.Write(writeCtx, &shortened)
+	endSpan(span, err)
+	if err != nil {
+		status, outcome := http.StatusInternalServerError, outcomeError
 		if h.persistence.IsErrUniqueConstraint(err) {
-			status = http.StatusConflict
+			status, outcome = http.StatusConflict, outcomeConflict
+			entry.Info("Short string already exists")
+		} else {
+			entry.WithError(err).Error("Persistence error")
 		}
+		h.createOutcome(ctx, short, outcome)
 		c.AbortWithStatusJSON(status, h.mapErr(err))
 		return
 	}
 
-	log.Printf("Successfully stored URL!")
+	h.createOutcome(ctx, short, outcomeCreated)
+	entry.Info("Short string is created")
 	c.JSONP(http.StatusCreated, shortened)
 }
 
-// Read long URL from database, based in short string, and execute the redirect.
+// createOutcome records the outcome of create on metrics and on the request span.
+func (h *Handler) createOutcome(ctx context.Context, short, outcome string) {
+	h.metrics.created(ctx, outcome)
+	annotateSpan(ctx, short, outcome)
+}
+
+// Read long URL from database, based in short string, and execute the redirect. Entries flagged for
+// preview, or short strings informed with preview suffix, show the preview page instead, unless
+// continuing from it. Protected entries require the password, informed via header or submitted on
+// the password prompt, and are redirected with "303 See Other" after the prompt. Entries limited by
+// maximum clicks are gone once all clicks are used, only redirects count as a click.
 func (h *Handler) Read(c *gin.Context) {
 	var short string
 	var shortened *Shortened
@@ -67,54 +145,271 @@ func (h *Handler) Read(c *gin.Context) {
 		c.AbortWithStatusJSON(http.StatusBadRequest, fmt.Errorf("short is not found as sub-path"))
 		return
 	}
+	short, forcePreview := trimPreviewSuffix(short)
 
-	log.Printf("Searching for long URL for short string '%s'", short)
-	if shortened, err = h.persistence.Read(
-		c.Request.Context(), short,
-	); err != nil && !h.persistence.IsErrNoRows(err) {
+	ctx := c.Request.Context()
+	entry := logEntry(ctx).WithField("short", short)
+	entry.Debug("Searching for long URL")
+	readCtx, span := startSpan(ctx, "shorty.persistence.read",
+		spanShortKey.String(short), spanBackendKey.String(storageBackend))
+	shortened, err = h.persistence.Read(readCtx, short)
+	if h.persistence.IsErrNoRows(err) {
+		err = nil
+	}
+	endSpan(span, err)
+	if err != nil {
+		annotateSpan(ctx, short, outcomeError)
+		entry.WithError(err).Error("Persistence error")
 		c.AbortWithStatusJSON(http.StatusInternalServerError, h.mapErr(err))
 		return
 	}
 
 	if shortened == nil {
-		log.Printf("No shortened URL is found for '%s' short string", short)
+		h.metrics.missed(ctx, missNotFound)
+		annotateSpan(ctx, short, missNotFound)
+		entry.Debug("No shortened URL is found")
 		c.AbortWithStatus(http.StatusNoContent)
 		return
 	}
+	if shortened.DeletedAt > 0 {
+		h.metrics.missed(ctx, missDeleted)
+		annotateSpan(ctx, short, missDeleted)
+		entry.Debug("Short string has been deleted")
+		c.AbortWithStatusJSON(http.StatusGone, gin.H{"msg": "short link has been deleted"})
+		return
+	}
 
-	log.Printf("Short string '%s' redirects to URL '%s'", short, shortened.URL)
+	if shortened.MaxClicks > 0 && shortened.Clicks >= shortened.MaxClicks {
+		h.exhausted(c, short)
+		return
+	}
+	if shortened.Protected && !h.unlock(c, shortened) {
+		return
+	}
+	if (shortened.Preview || forcePreview) && !c.GetBool(continueKey) {
+		annotateSpan(ctx, short, outcomePreviewed)
+		entry.WithField("url", shortened.URL).Debug("Showing preview of long URL")
+		h.preview(c, shortened)
+		return
+	}
+	if shortened.MaxClicks > 0 && !h.click(c, shortened) {
+		return
+	}
+
+	h.metrics.redirected(ctx)
+	annotateSpan(ctx, short, outcomeRedirected)
+	entry.WithField("url", shortened.URL).Debug("Redirecting to long URL")
+	status := http.StatusTemporaryRedirect
+	if c.Request.Method == http.MethodPost {
+		status = http.StatusSeeOther
+	}
 	c.Header("location", shortened.URL)
-	c.JSONP(http.StatusTemporaryRedirect, shortened)
+	c.JSONP(status, shortened)
 }
 
-// List shows all shortened URLs as a array of entries.
+// Info shows the entry of a short string, including deleted ones, as a lookup for management
+// clients. Unlike Read it never redirects, nor accounts a click, asks for password or shows the
+// preview page, therefore it must be guarded by restricted authorization.
+func (h *Handler) Info(c *gin.Context) {
+	shortened, err := h.persistence.Read(c.Request.Context(), c.Param("short"))
+	if err != nil {
+		h.abortOnMutationErr(c, err)
+		return
+	}
+	c.JSONP(http.StatusOK, shortened)
+}
+
+// List shows all shortened URLs as a array of entries. When "limit" query parameter is informed,
+// entries are ordered by short string and paginated, a page starts after the short string informed
+// as "after", and the next page is linked on "Link" header. Paginated entries are searched with
+// "q", matching short string or URL. URLs of protected entries are only shown, and searched, for
+// callers allowed to reveal them.
 func (h *Handler) List(c *gin.Context) {
-	slice, err := h.persistence.List(c.Request.Context())
+	var slice []*Shortened
+	var err error
+
+	ctx := c.Request.Context()
+	reveal := c.GetBool(revealKey)
+	limitParam, paginated := c.GetQuery("limit")
+	if !paginated {
+		slice, err = h.persistence.List(ctx)
+	} else {
+		limit, convErr := strconv.Atoi(limitParam)
+		if convErr != nil || limit < 1 || limit > maxPageSize {
+			err = fmt.Errorf("limit must be a number between 1 and %d", maxPageSize)
+			c.AbortWithStatusJSON(http.StatusBadRequest, h.mapErr(err))
+			return
+		}
+		// reading one extra entry to know whether a next page exists
+		search := c.Query("q")
+		slice, err = h.persistence.Page(ctx, c.Query("after"), search, limit+1, reveal)
+		if err == nil && len(slice) > limit {
+			slice = slice[:limit]
+			next := url.Values{"after": {slice[limit-1].Short}, "limit": {limitParam}}
+			if search != "" {
+				next.Set("q", search)
+			}
+			c.Header("Link", fmt.Sprintf(`<%s?%s>; rel="next"`, c.Request.URL.Path, next.Encode()))
+		}
+	}
 	if err != nil {
+		logEntry(ctx).WithError(err).Error("Persistence error")
 		c.AbortWithStatusJSON(http.StatusInternalServerError, h.mapErr(err))
+		return
+	}
+	if !reveal {
+		concealProtected(slice)
 	}
-	log.Printf("Found '%d' shortened entries.", len(slice))
+	logEntry(ctx).WithField("count", len(slice)).Debug("Found shortened entries")
 	c.JSONP(http.StatusOK, slice)
 }
 
+// updatePayload request body of update, preview flag is kept when not informed.
+type updatePayload struct {
+	URL     string `json:"url"`     // original URL
+	Preview *bool  `json:"preview"` // show preview page instead of redirecting
+}
+
+// Update replaces the URL, and optionally the preview flag, of a existing entry.
+func (h *Handler) Update(c *gin.Context) {
+	var payload updatePayload
+	var err error
+
+	short := c.Param("short")
+	if err = c.ShouldBindJSON(&payload); err != nil {
+		h.metrics.rejected(c.Request.Context(), err)
+		c.AbortWithStatusJSON(http.StatusUnprocessableEntity, h.mapErr(err))
+		return
+	}
+	if err = h.validateURL(c.Request, payload.URL); err != nil {
+		h.metrics.rejected(c.Request.Context(), err)
+		c.AbortWithStatusJSON(http.StatusBadRequest, h.mapErr(err))
+		return
+	}
+
+	logEntry(c.Request.Context()).WithField("short", short).Info("Updating short string")
+	err = h.persistence.Update(h.actorContext(c), short, payload.URL, payload.Preview)
+	if err != nil {
+		h.abortOnMutationErr(c, err)
+		return
+	}
+	h.respondWithEntry(c, short)
+}
+
+// Delete moves the entry to trash, it can be restored until purged.
+func (h *Handler) Delete(c *gin.Context) {
+	short := c.Param("short")
+
+	logEntry(c.Request.Context()).WithField("short", short).Info("Deleting short string")
+	if err := h.persistence.Delete(h.actorContext(c), short); err != nil {
+		h.abortOnMutationErr(c, err)
+		return
+	}
+	h.respondWithEntry(c, short)
+}
+
+// Trash shows deleted entries, waiting to be purged. URLs of protected entries are only shown for
+// callers allowed to reveal them.
+func (h *Handler) Trash(c *gin.Context) {
+	slice, err := h.persistence.Trash(c.Request.Context())
+	if err != nil {
+		logEntry(c.Request.Context()).WithError(err).Error("Persistence error")
+		c.AbortWithStatusJSON(http.StatusInternalServerError, h.mapErr(err))
+		return
+	}
+	if !c.GetBool(revealKey) {
+		concealProtected(slice)
+	}
+	logEntry(c.Request.Context()).WithField("count", len(slice)).Debug("Found deleted entries")
+	c.JSONP(http.StatusOK, slice)
+}
+
+// Restore brings back a deleted entry from trash.
+func (h *Handler) Restore(c *gin.Context) {
+	short := c.Param("short")
+
+	logEntry(c.Request.Context()).WithField("short", short).Info("Restoring short string")
+	if err := h.persistence.Undelete(h.actorContext(c), short); err != nil {
+		h.abortOnMutationErr(c, err)
+		return
+	}
+	h.respondWithEntry(c, short)
+}
+
+// abortOnMutationErr aborts with not-found status when no entry is affected by a mutation, or
+// internal server error otherwise.
+func (h *Handler) abortOnMutationErr(c *gin.Context, err error) {
+	status := http.StatusInternalServerError
+	if h.persistence.IsErrNoRows(err) {
+		status = http.StatusNotFound
+	} else {
+		logEntry(c.Request.Context()).WithError(err).Error("Persistence error")
+	}
+	c.AbortWithStatusJSON(status, h.mapErr(err))
+}
+
+// respondWithEntry reads the entry after a mutation, and responds with its contents.
+func (h *Handler) respondWithEntry(c *gin.Context, short string) {
+	shortened, err := h.persistence.Read(c.Request.Context(), short)
+	if err != nil {
+		h.abortOnMutationErr(c, err)
+		return
+	}
+	c.JSONP(http.StatusOK, shortened)
+}
+
+// validate check short string, long URL, password and maximum clicks of a new entry.
+func (h *Handler) validate(r *http.Request, s *Shortened) error {
+	if err := validateShort(s.Short); err != nil {
+		return err
+	}
+	if err := h.validateURL(r, s.URL); err != nil {
+		return err
+	}
+	if err := validatePassword(s.Password); err != nil {
+		return err
+	}
+	return validateMaxClicks(s.MaxClicks)
+}
+
+// validateShort check if short string is informed and does not clash with application endpoints.
+func validateShort(short string) error {
+	if short == "" {
+		return reject(rejectEmptyShort, "empty short string informed")
+	}
+	if strings.HasPrefix(short, reservedPrefix) {
+		return reject(rejectReservedShort, "short strings starting with '%s' are reserved",
+			reservedPrefix)
+	}
+	if strings.Contains(short, "/") {
+		return reject(rejectSlashShort, "short strings can't contain slashes")
+	}
+	if strings.HasSuffix(short, previewSuffix) {
+		return reject(rejectPreviewShort, "short strings ending with '%s' are reserved for preview",
+			previewSuffix)
+	}
+	return nil
+}
+
 // validateURL check if informed URL is valid and does not point to the same redirect service.
 func (h *Handler) validateURL(r *http.Request, longURL string) error {
 	var parsed *url.URL
 	var err error
 
 	if longURL == "" {
-		return fmt.Errorf("empty URL informed")
+		return reject(rejectEmptyURL, "empty URL informed")
 	}
 	if parsed, err = url.Parse(longURL); err != nil {
-		return err
+		return reject(rejectInvalidURL, "%s", err)
 	}
 
 	hostname := parsed.Hostname()
 	if hostname == r.Host {
-		return fmt.Errorf("redirects to the same service hostname ('%s') is not allowed", hostname)
+		return reject(rejectSameHost,
+			"redirects to the same service hostname ('%s') is not allowed", hostname)
 	}
 	if hostname == "127.0.0.1" || hostname == "localhost" {
-		return fmt.Errorf("redirects to localhost are not allowed")
+		return reject(rejectLocalhost, "redirects to localhost are not allowed")
 	}
 
 	return nil
@@ -127,5 +422,11 @@ func (h *Handler) mapErr(err error) gin.H {
 
 // NewHandler creates a new handler instance.
 func NewHandler(persistence *Persistence) *Handler {
-	return &Handler{persistence: persistence}
+	return &Handler{
+		persistence: persistence,
+		metrics:     newLinkMetrics(),
+		attempts: newAttemptLimiter(
+			defaultPasswordMaxAttempts, defaultPasswordLockout*time.Second),
+		bulkChunkSize: bulkChunkSize,
+	}
 }
@@ -1,9 +1,12 @@
 package shorty
 
 import (
+	"context"
+	"encoding/json"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"os"
 	"strings"
 	"testing"
 
@@ -30,15 +33,23 @@ func TestHandlerValidateURL(t *testing.T) {
 	assert.NotNil(t, handler.validateURL(req, "http://shorty.com/shorty"))
 }
 
+func TestHandlerValidateShort(t *testing.T) {
+	assert.Nil(t, validateShort("abc"))
+	assert.NotNil(t, validateShort(""))
+	assert.NotNil(t, validateShort("_bulk"))
+	assert.NotNil(t, validateShort("a/b"))
+	assert.NotNil(t, validateShort("abc+"))
+}
+
 func TestHandlerNew(t *testing.T) {
 	DeleteDatabaseFile(t)
-	p, _ := NewPersistence(&Config{DatabaseFile: databaseFile})
+	p, _ := NewPersistence(&Config{StorageConfig: StorageConfig{DatabaseFile: databaseFile}})
 
 	handler = NewHandler(p)
 	assert.NotNil(t, handler)
 }
 
-func recorderServeHTTP(router *gin.Engine, req *http.Request) *httptest.ResponseRecorder {
+func recorderServeHTTP(router http.Handler, req *http.Request) *httptest.ResponseRecorder {
 	rr := httptest.NewRecorder()
 	router.ServeHTTP(rr, req)
 	return rr
@@ -144,3 +155,138 @@ func TestHandlerRead(t *testing.T) {
 	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
 	assert.Equal(t, longURL, rr.Result().Header.Get("location"))
 }
+
+func TestHandlerUpdate(t *testing.T) {
+	router := gin.Default()
+	router.PUT("/:short", handler.Update)
+
+	payload := strings.NewReader(fmt.Sprintf("{\"url\":\"%s\"}", longURL))
+	req, err := http.NewRequest("PUT", fmt.Sprintf("/%s", short), payload)
+	assert.Nil(t, err)
+
+	rr := recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	payload = strings.NewReader(fmt.Sprintf("{\"url\":\"%s\"}", longURL))
+	req, err = http.NewRequest("PUT", "/notfound", payload)
+	assert.Nil(t, err)
+
+	rr = recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestHandlerDelete(t *testing.T) {
+	router := gin.Default()
+	router.DELETE("/:short", handler.Delete)
+	router.GET("/:short", handler.Read)
+
+	req, err := http.NewRequest("DELETE", fmt.Sprintf("/%s", short), nil)
+	assert.Nil(t, err)
+
+	rr := recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	t.Log("Deleting again must not find the entry")
+	rr = recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("/%s", short), nil)
+	assert.Nil(t, err)
+
+	rr = recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusGone, rr.Code)
+}
+
+func TestHandlerTrash(t *testing.T) {
+	router := gin.Default()
+	router.GET("/_trash", handler.Trash)
+
+	req, err := http.NewRequest("GET", "/_trash", nil)
+	assert.Nil(t, err)
+
+	rr := recorderServeHTTP(router, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), fmt.Sprintf("\"short\":\"%s\"", short))
+}
+
+func TestHandlerRestore(t *testing.T) {
+	router := gin.Default()
+	router.POST("/:short/restore", handler.Restore)
+	router.GET("/:short", handler.Read)
+
+	req, err := http.NewRequest("POST", fmt.Sprintf("/%s/restore", short), nil)
+	assert.Nil(t, err)
+
+	rr := recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	req, err = http.NewRequest("GET", fmt.Sprintf("/%s", short), nil)
+	assert.Nil(t, err)
+
+	rr = recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+}
+
+func TestHandlerListPaginated(t *testing.T) {
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-list.sqlite"
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	for _, s := range []string{"c", "a", "e", "b", "d"} {
+		assert.Nil(t, p.Write(context.Background(), &Shortened{Short: s, URL: longURL}))
+	}
+	assert.Nil(t, p.Delete(context.Background(), "d"))
+
+	h := NewHandler(p)
+	router := gin.New()
+	router.GET("/shorty/", h.List)
+
+	t.Log("Pages must be ordered by short string, linking the next page")
+	assert.Equal(t, []string{"a", "b", "c", "e"}, listPages(t, router, "/shorty/?limit=2"))
+
+	for _, s := range []*Shortened{
+		{Short: "x1", URL: "http://needle.com/1"},
+		{Short: "x2", URL: "http://NEEDLE.com/2"},
+		{Short: "needle", URL: longURL},
+		{Short: "x_3", URL: longURL},
+	} {
+		assert.Nil(t, p.Write(context.Background(), s))
+	}
+
+	t.Log("Search must match short string or URL, ignoring case, on every page")
+	assert.Equal(t, []string{"needle", "x1", "x2"}, listPages(t, router, "/shorty/?limit=1&q=Needle"))
+	assert.Equal(t, []string{"x_3"}, listPages(t, router, "/shorty/?limit=2&q=_"))
+
+	for _, limit := range []string{"0", "bogus", "1001"} {
+		req := httptest.NewRequest("GET", "/shorty/?limit="+limit, nil)
+		assert.Equal(t, http.StatusBadRequest, recorderServeHTTP(router, req).Code)
+	}
+}
+
+// listPages follows the links to next pages, starting on informed path, returning short strings.
+func listPages(t *testing.T, router http.Handler, next string) []string {
+	shorts := []string{}
+	for next != "" {
+		rr := recorderServeHTTP(router, httptest.NewRequest("GET", next, nil))
+		assert.Equal(t, http.StatusOK, rr.Code)
+		page := []*Shortened{}
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &page))
+		assert.True(t, len(page) <= 2)
+		for _, s := range page {
+			shorts = append(shorts, s.Short)
+		}
+
+		next = ""
+		if link := rr.Header().Get("Link"); link != "" {
+			next = strings.TrimSuffix(strings.TrimPrefix(link, "<"), `>; rel="next"`)
+		}
+	}
+	return shorts
+}
@@ -0,0 +1,86 @@
+package shorty
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readinessTimeout timeout for the dependency checks of readiness endpoint.
+const readinessTimeout = 2 * time.Second
+
+// Check statuses.
+const (
+	CheckOK      = "ok"
+	CheckFailing = "failing"
+)
+
+// Check represents the outcome of a single readiness check.
+type Check struct {
+	Status string `json:"status"`        // ok or failing
+	Msg    string `json:"msg,omitempty"` // error message, when failing
+}
+
+// Readiness represents the overall readiness and the breakdown of each check.
+type Readiness struct {
+	Status string            `json:"status"` // ok when all checks are ok, failing otherwise
+	Checks map[string]*Check `json:"checks"` // checks by name
+}
+
+// newCheck creates a check out of a error, nil error means ok.
+func newCheck(err error) *Check {
+	if err != nil {
+		return &Check{Status: CheckFailing, Msg: err.Error()}
+	}
+	return &Check{Status: CheckOK}
+}
+
+// Healthz liveness endpoint, answers as long as the process is able to serve requests.
+func (s *Shorty) Healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": CheckOK})
+}
+
+// Readyz readiness endpoint, checks database connectivity, schema migrations, background workers,
+// and fails during graceful shutdown.
+func (s *Shorty) Readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	readiness := &Readiness{Status: CheckOK, Checks: map[string]*Check{
+		"database":   newCheck(s.persistence.Ping(ctx)),
+		"migrations": newCheck(s.persistence.Migrated(ctx)),
+		"workers":    newCheck(s.workersCheck()),
+		"shutdown":   newCheck(s.shutdownCheck()),
+	}}
+
+	status := http.StatusOK
+	for _, check := range readiness.Checks {
+		if check.Status != CheckOK {
+			readiness.Status = CheckFailing
+			status = http.StatusServiceUnavailable
+		}
+	}
+	c.JSON(status, readiness)
+}
+
+// workersCheck asserts all started background workers are still running.
+func (s *Shorty) workersCheck() error {
+	started := atomic.LoadInt32(&s.workersStarted)
+	running := atomic.LoadInt32(&s.workersRunning)
+	if running < started {
+		return fmt.Errorf("'%d' of '%d' background workers are running", running, started)
+	}
+	return nil
+}
+
+// shutdownCheck asserts the application is not shutting down.
+func (s *Shorty) shutdownCheck() error {
+	if atomic.LoadInt32(&s.shuttingDown) == 1 {
+		return fmt.Errorf("shutting down")
+	}
+	return nil
+}
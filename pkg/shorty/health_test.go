@@ -0,0 +1,84 @@
+package shorty
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+// readyz requests readiness endpoint, returning status code and parsed body.
+func readyz(t *testing.T, s *Shorty) (int, *Readiness) {
+	router := gin.Default()
+	router.GET("/readyz", s.Readyz)
+
+	req, err := http.NewRequest("GET", "/readyz", nil)
+	assert.Nil(t, err)
+
+	rr := recorderServeHTTP(router, req)
+
+	readiness := &Readiness{}
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), readiness))
+	return rr.Code, readiness
+}
+
+func TestHealthHealthz(t *testing.T) {
+	s := &Shorty{}
+	router := gin.Default()
+	router.GET("/healthz", s.Healthz)
+
+	req, err := http.NewRequest("GET", "/healthz", nil)
+	assert.Nil(t, err)
+
+	rr := recorderServeHTTP(router, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "{\"status\":\"ok\"}", rr.Body.String())
+}
+
+func TestHealthReadyz(t *testing.T) {
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-health.sqlite",
+	}}
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+
+	s := &Shorty{
+		config:      config,
+		persistence: p,
+		done:        make(chan struct{}),
+		workers:     &sync.WaitGroup{},
+	}
+	s.startWorker(func() { <-s.done })
+
+	code, readiness := readyz(t, s)
+	assert.Equal(t, http.StatusOK, code)
+	assert.Equal(t, CheckOK, readiness.Status)
+	assert.Len(t, readiness.Checks, 4)
+
+	t.Log("Readiness must fail when a background worker is not running")
+	s.startWorker(func() {})
+	for atomic.LoadInt32(&s.workersRunning) > 1 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	code, readiness = readyz(t, s)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, CheckFailing, readiness.Checks["workers"].Status)
+	assert.Equal(t, CheckOK, readiness.Checks["database"].Status)
+
+	t.Log("Readiness must fail during shutdown, and when database is closed")
+	atomic.StoreInt32(&s.shuttingDown, 1)
+	s.stopWorkers()
+	p.Close()
+	code, readiness = readyz(t, s)
+	assert.Equal(t, http.StatusServiceUnavailable, code)
+	assert.Equal(t, CheckFailing, readiness.Checks["shutdown"].Status)
+	assert.Equal(t, CheckFailing, readiness.Checks["database"].Status)
+}
@@ -0,0 +1,135 @@
+package shorty
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+)
+
+const (
+	// unixPrefix address prefix for unix domain sockets, as in "unix:/run/shorty.sock".
+	unixPrefix = "unix:"
+	// systemdPrefix address prefix for listeners inherited via systemd socket activation, followed
+	// by the optional file descriptor name, as in "systemd:shorty.socket".
+	systemdPrefix = "systemd:"
+	// listenFdsStart first file descriptor passed by systemd socket activation.
+	listenFdsStart = 3
+	// defaultSocketMode default unix domain socket file permissions.
+	defaultSocketMode = "0660"
+)
+
+// inheritedListener listener passed by systemd, and its file descriptor name.
+type inheritedListener struct {
+	name     string
+	listener net.Listener
+}
+
+// parseSocketMode parses unix socket file permissions, informed in octal.
+func parseSocketMode(value string) (os.FileMode, error) {
+	mode, err := strconv.ParseUint(value, 8, 32)
+	if err != nil || mode > 0777 {
+		return 0, fmt.Errorf("invalid socket mode '%s', expected octal permissions", value)
+	}
+	return os.FileMode(mode), nil
+}
+
+// listenUnix listens on unix domain socket path, applying the informed permissions. A stale socket
+// file left behind by a previous run is removed, unless another process is still accepting on it.
+func listenUnix(path string, mode os.FileMode) (net.Listener, error) {
+	if info, err := os.Stat(path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if conn, err := net.Dial("unix", path); err == nil {
+			conn.Close()
+			return nil, fmt.Errorf("unix socket '%s' is already in use", path)
+		}
+		if err = os.Remove(path); err != nil {
+			return nil, err
+		}
+	}
+
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if err = os.Chmod(path, mode); err != nil {
+		listener.Close()
+		return nil, err
+	}
+	return listener, nil
+}
+
+// systemdListeners listeners passed by systemd socket activation, described by LISTEN_PID,
+// LISTEN_FDS and LISTEN_FDNAMES environment variables, starting on the informed file descriptor.
+func systemdListeners(getenv func(string) string, firstFd int) ([]*inheritedListener, error) {
+	if pid := getenv("LISTEN_PID"); pid != "" && pid != strconv.Itoa(os.Getpid()) {
+		return nil, nil
+	}
+	count, err := strconv.Atoi(getenv("LISTEN_FDS"))
+	if err != nil || count <= 0 {
+		return nil, nil
+	}
+	names := strings.Split(getenv("LISTEN_FDNAMES"), ":")
+
+	inherited := []*inheritedListener{}
+	for i := 0; i < count; i++ {
+		file := os.NewFile(uintptr(firstFd+i), fmt.Sprintf("listen-fd-%d", firstFd+i))
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inherited file descriptor '%d' is not a listener: %s",
+				firstFd+i, err)
+		}
+
+		name := ""
+		if i < len(names) {
+			name = names[i]
+		}
+		inherited = append(inherited, &inheritedListener{name: name, listener: listener})
+	}
+	return inherited, nil
+}
+
+// inherit takes the listener passed by systemd with the informed name, or the first listener not
+// taken yet when name is empty. Listeners are loaded on first use.
+func (s *Shorty) inherit(name string) (net.Listener, error) {
+	if s.inherited == nil {
+		inherited, err := systemdListeners(os.Getenv, listenFdsStart)
+		if err != nil {
+			return nil, err
+		}
+		for _, env := range []string{"LISTEN_PID", "LISTEN_FDS", "LISTEN_FDNAMES"} {
+			os.Unsetenv(env)
+		}
+		s.inherited = inherited
+	}
+
+	for i, inherited := range s.inherited {
+		if name == "" || inherited.name == name {
+			s.inherited = append(s.inherited[:i], s.inherited[i+1:]...)
+			return inherited.listener, nil
+		}
+	}
+	return nil, fmt.Errorf("no listener named '%s' is passed by systemd socket activation", name)
+}
+
+// listen creates the listener for address, which can be a TCP address, a unix domain socket
+// prefixed by "unix:", or a listener inherited from systemd prefixed by "systemd:".
+func (s *Shorty) listen(address string) (net.Listener, error) {
+	switch {
+	case strings.HasPrefix(address, systemdPrefix):
+		return s.inherit(strings.TrimPrefix(address, systemdPrefix))
+	case strings.HasPrefix(address, unixPrefix):
+		socketMode := s.config.SocketMode
+		if socketMode == "" {
+			socketMode = defaultSocketMode
+		}
+		mode, err := parseSocketMode(socketMode)
+		if err != nil {
+			return nil, err
+		}
+		return listenUnix(strings.TrimPrefix(address, unixPrefix), mode)
+	default:
+		return net.Listen("tcp", address)
+	}
+}
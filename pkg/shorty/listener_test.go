@@ -0,0 +1,148 @@
+package shorty
+
+import (
+	"context"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const unixSocketFile = "/var/tmp/shorty-test.sock"
+
+func TestListenerParseSocketMode(t *testing.T) {
+	mode, err := parseSocketMode("0660")
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0660), mode)
+
+	for _, value := range []string{"", "bogus", "0999", "01777"} {
+		_, err = parseSocketMode(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestListenerListenUnix(t *testing.T) {
+	_ = os.Remove(unixSocketFile)
+
+	listener, err := listenUnix(unixSocketFile, 0600)
+	assert.Nil(t, err)
+	info, err := os.Stat(unixSocketFile)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	t.Log("Sockets in use must not be replaced")
+	go func(listener net.Listener) {
+		if conn, err := listener.Accept(); err == nil {
+			conn.Close()
+		}
+	}(listener)
+	_, err = listenUnix(unixSocketFile, 0600)
+	assert.Error(t, err)
+	listener.Close()
+
+	t.Log("Stale sockets must be replaced")
+	stale, err := net.ListenUnix("unix", &net.UnixAddr{Name: unixSocketFile, Net: "unix"})
+	assert.Nil(t, err)
+	stale.SetUnlinkOnClose(false)
+	stale.Close()
+
+	listener, err = listenUnix(unixSocketFile, 0660)
+	assert.Nil(t, err)
+	listener.Close()
+}
+
+func TestListenerSystemd(t *testing.T) {
+	tcpListener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(t, err)
+	defer tcpListener.Close()
+	file, err := tcpListener.(*net.TCPListener).File()
+	assert.Nil(t, err)
+	// duplicated file descriptor is taken over, and closed, by systemdListeners
+	fd, err := syscall.Dup(int(file.Fd()))
+	assert.Nil(t, err)
+	file.Close()
+
+	env := map[string]string{
+		"LISTEN_PID":     strconv.Itoa(os.Getpid()),
+		"LISTEN_FDS":     "1",
+		"LISTEN_FDNAMES": "public",
+	}
+	getenv := func(key string) string {
+		return env[key]
+	}
+
+	inherited, err := systemdListeners(getenv, fd)
+	assert.Nil(t, err)
+	assert.Len(t, inherited, 1)
+	assert.Equal(t, "public", inherited[0].name)
+	assert.Equal(t, tcpListener.Addr().String(), inherited[0].listener.Addr().String())
+	inherited[0].listener.Close()
+
+	t.Log("Listeners passed to other processes must be ignored")
+	env["LISTEN_PID"] = "1"
+	inherited, err = systemdListeners(getenv, fd)
+	assert.Nil(t, err)
+	assert.Len(t, inherited, 0)
+
+	s := &Shorty{inherited: []*inheritedListener{{name: "public", listener: tcpListener}}}
+	_, err = s.inherit("admin")
+	assert.Error(t, err)
+	listener, err := s.inherit("public")
+	assert.Nil(t, err)
+	assert.Equal(t, tcpListener, listener)
+}
+
+func TestListenerHTTPServerUnix(t *testing.T) {
+	_ = os.Remove(unixSocketFile)
+
+	config := NewConfig()
+	config.Address = unixPrefix + unixSocketFile
+	assert.Nil(t, config.Validate())
+
+	s := &Shorty{
+		config:   config,
+		engine:   gin.New(),
+		stopChan: make(chan os.Signal, 1),
+		done:     make(chan struct{}),
+		workers:  &sync.WaitGroup{},
+	}
+	s.engine.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "unix")
+	})
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- s.httpServer()
+	}()
+	time.Sleep(time.Second)
+
+	info, err := os.Stat(unixSocketFile)
+	assert.Nil(t, err)
+	assert.Equal(t, os.FileMode(0660), info.Mode().Perm())
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", unixSocketFile)
+		},
+	}}
+	res, err := client.Get("http://shorty/")
+	assert.Nil(t, err)
+	body, err := ioutil.ReadAll(res.Body)
+	assert.Nil(t, err)
+	assert.Equal(t, "unix", string(body))
+
+	s.Shutdown()
+	assert.Nil(t, <-serverErr)
+
+	t.Log("Socket file must be removed on shutdown")
+	_, err = os.Stat(unixSocketFile)
+	assert.True(t, os.IsNotExist(err))
+}
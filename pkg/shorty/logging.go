@@ -0,0 +1,132 @@
+package shorty
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Log output formats.
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+const (
+	// defaultLogLevel log level used when not informed.
+	defaultLogLevel = "info"
+	// requestIDHeader header carrying the request ID, informed by clients or generated.
+	requestIDHeader = "X-Request-ID"
+	// requestIDKey gin context key, and log field, for the request ID.
+	requestIDKey = "request_id"
+	// requestIDMaxLength longest request ID accepted from clients.
+	requestIDMaxLength = 128
+)
+
+// logger application logger, configured by SetLogging.
+var logger = logrus.New()
+
+// requestIDContextKey context key type for the request ID.
+type requestIDContextKey struct{}
+
+// parseLogLevel parses log level name, empty means the default level.
+func parseLogLevel(level string) (logrus.Level, error) {
+	if level == "" {
+		level = defaultLogLevel
+	}
+	parsed, err := logrus.ParseLevel(level)
+	if err != nil {
+		return parsed, fmt.Errorf("invalid value for log-level: '%s'", level)
+	}
+	return parsed, nil
+}
+
+// newLogFormatter formatter for the output format, empty means text.
+func newLogFormatter(format string) (logrus.Formatter, error) {
+	switch format {
+	case "", LogFormatText:
+		return &logrus.TextFormatter{FullTimestamp: true}, nil
+	case LogFormatJSON:
+		return &logrus.JSONFormatter{}, nil
+	}
+	return nil, fmt.Errorf("invalid value for log-format: '%s'", format)
+}
+
+// SetLogging configures the application logger level and output format.
+func SetLogging(level, format string) error {
+	parsed, err := parseLogLevel(level)
+	if err != nil {
+		return err
+	}
+	formatter, err := newLogFormatter(format)
+	if err != nil {
+		return err
+	}
+	logger.SetLevel(parsed)
+	logger.SetFormatter(formatter)
+	return nil
+}
+
+// Logger returns the application logger, shared with command-line tools.
+func Logger() *logrus.Logger {
+	return logger
+}
+
+// WithRequestID returns a copy of context carrying the request ID.
+func WithRequestID(ctx context.Context, requestID string) context.Context {
+	return context.WithValue(ctx, requestIDContextKey{}, requestID)
+}
+
+// requestIDFromContext extracts request ID from context, empty when not present.
+func requestIDFromContext(ctx context.Context) string {
+	requestID, _ := ctx.Value(requestIDContextKey{}).(string)
+	return requestID
+}
+
+// logEntry log entry carrying the request ID, when present in context.
+func logEntry(ctx context.Context) *logrus.Entry {
+	if requestID := requestIDFromContext(ctx); requestID != "" {
+		return logger.WithField(requestIDKey, requestID)
+	}
+	return logrus.NewEntry(logger)
+}
+
+// newRequestID generates a random request ID.
+func newRequestID() string {
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return ""
+	}
+	return hex.EncodeToString(id)
+}
+
+// validRequestID checks request ID informed by clients, accepting printable ASCII without spaces.
+func validRequestID(requestID string) bool {
+	if requestID == "" || len(requestID) > requestIDMaxLength {
+		return false
+	}
+	for _, r := range requestID {
+		if r <= ' ' || r > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// requestID middleware to take the request ID from header, or generate a new one, and add it to gin
+// and request contexts, so all log lines carry it. The request ID is echoed in response headers.
+func requestID(c *gin.Context) {
+	id := c.GetHeader(requestIDHeader)
+	if !validRequestID(id) {
+		id = newRequestID()
+	}
+
+	c.Set(requestIDKey, id)
+	c.Header(requestIDHeader, id)
+	c.Request = c.Request.WithContext(WithRequestID(c.Request.Context(), id))
+	c.Next()
+}
@@ -0,0 +1,85 @@
+package shorty
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoggingSetLogging(t *testing.T) {
+	assert.Nil(t, SetLogging("debug", LogFormatJSON))
+	assert.Equal(t, "debug", logger.GetLevel().String())
+	assert.Nil(t, SetLogging("", ""))
+	assert.Equal(t, defaultLogLevel, logger.GetLevel().String())
+
+	assert.Error(t, SetLogging("bogus", LogFormatText))
+	assert.Error(t, SetLogging("info", "bogus"))
+}
+
+func TestLoggingValidRequestID(t *testing.T) {
+	assert.True(t, validRequestID("4f2a9c0e-8b1d"))
+	assert.False(t, validRequestID(""))
+	assert.False(t, validRequestID("with space"))
+	assert.False(t, validRequestID("line\nbreak"))
+	assert.False(t, validRequestID(strings.Repeat("x", requestIDMaxLength+1)))
+
+	assert.Len(t, newRequestID(), 32)
+	assert.NotEqual(t, newRequestID(), newRequestID())
+}
+
+func TestLoggingRequestID(t *testing.T) {
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-logging.sqlite",
+	}}
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	var out bytes.Buffer
+	logger.SetOutput(&out)
+	defer logger.SetOutput(os.Stderr)
+	assert.Nil(t, SetLogging("debug", LogFormatJSON))
+	defer SetLogging("", "")
+
+	h := NewHandler(p)
+	router := gin.New()
+	router.Use(requestID)
+	router.POST("/shorty/:short", h.Create)
+	router.GET("/shorty/:short", h.Read)
+
+	t.Log("Informed request ID must be echoed, and present on all log lines")
+	body := strings.NewReader(`{"url":"http://x.y.z"}`)
+	req, err := http.NewRequest("POST", "/shorty/"+short, body)
+	assert.Nil(t, err)
+	req.Header.Set(requestIDHeader, "informed-id")
+	res := recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusCreated, res.Code)
+	assert.Equal(t, "informed-id", res.Header().Get(requestIDHeader))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.True(t, len(lines) > 1)
+	for _, line := range lines {
+		entry := map[string]interface{}{}
+		assert.Nil(t, json.Unmarshal([]byte(line), &entry), line)
+		assert.Equal(t, "informed-id", entry[requestIDKey], line)
+	}
+
+	t.Log("Request ID must be generated when not informed")
+	req, err = http.NewRequest("GET", "/shorty/"+short, nil)
+	assert.Nil(t, err)
+	res = recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusTemporaryRedirect, res.Code)
+	assert.Len(t, res.Header().Get(requestIDHeader), 32)
+
+	assert.Equal(t, "", requestIDFromContext(context.Background()))
+	ctx := WithRequestID(context.Background(), "id")
+	assert.Equal(t, "id", logEntry(ctx).Data[requestIDKey])
+}
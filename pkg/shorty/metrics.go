@@ -0,0 +1,135 @@
+package shorty
+
+import (
+	"context"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/unit"
+)
+
+// Link metric names, exported in Prometheus format with dots replaced by underscores.
+const (
+	redirectsMetric      = "shorty.redirects.total"
+	redirectMissesMetric = "shorty.redirect.misses.total"
+	createsMetric        = "shorty.creates.total"
+	rejectionsMetric     = "shorty.validation.rejections.total"
+	linksMetric          = "shorty.links"
+	storageLatencyMetric = "shorty.storage.latency"
+)
+
+// Link metric attributes.
+const (
+	outcomeKey   = attribute.Key("outcome")
+	reasonKey    = attribute.Key("reason")
+	operationKey = attribute.Key("operation")
+)
+
+// Create and redirect outcomes.
+const (
+	outcomeCreated    = "created"
+	outcomeConflict   = "conflict"
+	outcomeInvalid    = "invalid"
+	outcomeError      = "error"
+	outcomeRedirected = "redirected"
+	outcomePreviewed  = "previewed"
+	outcomeProtected  = "protected"
+	outcomeLocked     = "locked"
+)
+
+// Redirect miss reasons.
+const (
+	missNotFound  = "not_found"
+	missDeleted   = "deleted"
+	missExhausted = "exhausted"
+)
+
+// linkMetrics counts redirects, creates and validation rejections.
+type linkMetrics struct {
+	redirects  metric.Int64Counter
+	misses     metric.Int64Counter
+	creates    metric.Int64Counter
+	rejections metric.Int64Counter
+}
+
+// redirected counts a redirect served.
+func (m *linkMetrics) redirected(ctx context.Context) {
+	m.redirects.Add(ctx, 1)
+}
+
+// missed counts a redirect not served, because the short string is not found or deleted.
+func (m *linkMetrics) missed(ctx context.Context, reason string) {
+	m.misses.Add(ctx, 1, reasonKey.String(reason))
+}
+
+// created counts a create attempt by outcome.
+func (m *linkMetrics) created(ctx context.Context, outcome string) {
+	m.creates.Add(ctx, 1, outcomeKey.String(outcome))
+}
+
+// rejected counts a validation rejection, by the reason carried on error.
+func (m *linkMetrics) rejected(ctx context.Context, err error) {
+	reason := rejectMalformed
+	if r, ok := err.(*rejection); ok {
+		reason = r.reason
+	}
+	m.rejections.Add(ctx, 1, reasonKey.String(reason))
+}
+
+// newLinkMetrics creates link instruments using the global meter provider.
+func newLinkMetrics() *linkMetrics {
+	meter := metric.Must(global.Meter(instrumentationName))
+	return &linkMetrics{
+		redirects: meter.NewInt64Counter(redirectsMetric,
+			metric.WithDescription("The number of redirects served")),
+		misses: meter.NewInt64Counter(redirectMissesMetric,
+			metric.WithDescription("The number of redirects not served, by reason")),
+		creates: meter.NewInt64Counter(createsMetric,
+			metric.WithDescription("The number of link creation attempts, by outcome")),
+		rejections: meter.NewInt64Counter(rejectionsMetric,
+			metric.WithDescription("The number of validation rejections, by reason")),
+	}
+}
+
+// storageMetrics records the latency of persistence operations.
+type storageMetrics struct {
+	latency metric.Float64Histogram
+}
+
+// measure starts measuring the operation, the returned function records its latency.
+func (m *storageMetrics) measure(ctx context.Context, operation string) func() {
+	start := time.Now()
+	return func() {
+		m.latency.Record(ctx, float64(time.Since(start))/float64(time.Millisecond),
+			operationKey.String(operation))
+	}
+}
+
+// newStorageMetrics creates storage instruments using the global meter provider.
+func newStorageMetrics() *storageMetrics {
+	meter := metric.Must(global.Meter(instrumentationName))
+	return &storageMetrics{
+		latency: meter.NewFloat64Histogram(storageLatencyMetric,
+			metric.WithDescription("The latency of storage operations, by operation"),
+			metric.WithUnit(unit.Milliseconds)),
+	}
+}
+
+// registerLinksGauge observes the total of links, except deleted, counted on every collection.
+func registerLinksGauge(p *Persistence) error {
+	meter := global.Meter(instrumentationName)
+	_, err := meter.NewInt64GaugeObserver(linksMetric,
+		func(ctx context.Context, result metric.Int64ObserverResult) {
+			total, err := p.Count(ctx)
+			if err != nil {
+				logEntry(ctx).WithError(err).Error("Error on counting links")
+				return
+			}
+			result.Observe(total)
+		},
+		metric.WithDescription("The total of links, except deleted"),
+	)
+	return err
+}
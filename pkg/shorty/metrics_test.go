@@ -0,0 +1,89 @@
+package shorty
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsLinks(t *testing.T) {
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-metrics.sqlite"
+	_ = os.Remove(config.DatabaseFile)
+
+	registry := prometheus.NewRegistry()
+	tel, err := newTelemetry(config, registry, registry)
+	assert.Nil(t, err)
+
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	assert.Nil(t, registerLinksGauge(p))
+
+	h := NewHandler(p)
+	router := gin.New()
+	router.POST("/shorty/:short", h.Create)
+	router.GET("/shorty/:short", h.Read)
+	router.DELETE("/shorty/:short", h.Delete)
+
+	create := func(short, longURL string) int {
+		body := strings.NewReader(fmt.Sprintf(`{"url":"%s"}`, longURL))
+		return recorderServeHTTP(router, httptest.NewRequest("POST", "/shorty/"+short, body)).Code
+	}
+	assert.Equal(t, http.StatusCreated, create("one", longURL))
+	assert.Equal(t, http.StatusCreated, create("two", longURL))
+	assert.Equal(t, http.StatusConflict, create("one", longURL))
+	assert.Equal(t, http.StatusBadRequest, create("three", "http://localhost/path"))
+	assert.Equal(t, http.StatusBadRequest, create("_reserved", longURL))
+
+	for _, path := range []string{"/shorty/one", "/shorty/one", "/shorty/missing"} {
+		recorderServeHTTP(router, httptest.NewRequest("GET", path, nil))
+	}
+	assert.Nil(t, p.Delete(context.Background(), "two"))
+	recorderServeHTTP(router, httptest.NewRequest("GET", "/shorty/two", nil))
+
+	res := recorderServeHTTP(tel, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	metrics := res.Body.String()
+
+	for _, line := range []string{
+		"shorty_redirects_total 2",
+		`shorty_redirect_misses_total{reason="not_found"} 1`,
+		`shorty_redirect_misses_total{reason="deleted"} 1`,
+		`shorty_creates_total{outcome="created"} 2`,
+		`shorty_creates_total{outcome="conflict"} 1`,
+		`shorty_creates_total{outcome="invalid"} 2`,
+		`shorty_validation_rejections_total{reason="localhost"} 1`,
+		`shorty_validation_rejections_total{reason="reserved_short"} 1`,
+		"shorty_links 1",
+		`shorty_storage_latency_count{operation="write"} 3`,
+		`shorty_storage_latency_count{operation="read"} 4`,
+	} {
+		assert.Contains(t, metrics, line)
+	}
+}
+
+func TestMetricsRejectionReason(t *testing.T) {
+	req := httptest.NewRequest("POST", "http://shorty.com/shorty/abc", nil)
+	for reason, err := range map[string]error{
+		rejectEmptyShort:    validateShort(""),
+		rejectSlashShort:    validateShort("a/b"),
+		rejectEmptyURL:      handler.validateURL(req, ""),
+		rejectInvalidURL:    handler.validateURL(req, "http://[::1"),
+		rejectSameHost:      handler.validateURL(req, "http://shorty.com/path"),
+		rejectLocalhost:     handler.validateURL(req, "http://127.0.0.1/path"),
+		rejectReservedShort: validateShort("_bulk"),
+	} {
+		r, ok := err.(*rejection)
+		assert.True(t, ok, reason)
+		assert.Equal(t, reason, r.reason)
+	}
+}
@@ -0,0 +1,181 @@
+package shorty
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/sirupsen/logrus"
+)
+
+// Actions authorized for client identities.
+const (
+	ActionRead   = "read"
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+	ActionAdmin  = "admin"
+)
+
+const (
+	// identityKey gin context key for the authenticated client identity.
+	identityKey = "identity"
+	// subjectKey gin context key for the authenticated client certificate subject.
+	subjectKey = "subject"
+)
+
+// ClientIdentity identity mapped from a client certificate subject, and the actions it's allowed
+// to perform. Reading is allowed for any identity.
+type ClientIdentity struct {
+	Name    string   // identity name, recorded as actor in audit log
+	Actions []string // allowed actions
+}
+
+// Allows checks if identity is allowed to perform the action.
+func (i *ClientIdentity) Allows(action string) bool {
+	if action == ActionRead {
+		return true
+	}
+	for _, allowed := range i.Actions {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+// isAction checks if informed value is a known action.
+func isAction(value string) bool {
+	switch value {
+	case ActionRead, ActionCreate, ActionUpdate, ActionDelete, ActionAdmin:
+		return true
+	}
+	return false
+}
+
+// ParseClientIdentities parses the mapping of certificate subject common-names to identities,
+// formatted as "<common-name>=<identity>:<action>[,<action>]", split by semicolon. For instance:
+// "deploy-bot.acme.com=deployer:create,update;ops.acme.com=ops:create,update,delete,admin".
+func ParseClientIdentities(value string) (map[string]*ClientIdentity, error) {
+	identities := map[string]*ClientIdentity{}
+	for _, entry := range strings.Split(value, ";") {
+		if entry = strings.TrimSpace(entry); entry == "" {
+			continue
+		}
+
+		eq := strings.LastIndex(entry, "=")
+		if eq <= 0 {
+			return nil, fmt.Errorf(
+				"invalid client identity '%s', expected '<common-name>=<identity>:<actions>'", entry)
+		}
+		commonName := entry[:eq]
+		name, actions := entry[eq+1:], ""
+		if colon := strings.Index(name, ":"); colon >= 0 {
+			name, actions = name[:colon], name[colon+1:]
+		}
+		if name == "" {
+			return nil, fmt.Errorf("empty identity name for common-name '%s'", commonName)
+		}
+
+		identity := &ClientIdentity{Name: name, Actions: []string{}}
+		for _, action := range strings.Split(actions, ",") {
+			if action = strings.TrimSpace(action); action == "" {
+				continue
+			}
+			if !isAction(action) {
+				return nil, fmt.Errorf("invalid action '%s' for common-name '%s'", action, commonName)
+			}
+			identity.Actions = append(identity.Actions, action)
+		}
+		identities[commonName] = identity
+	}
+	return identities, nil
+}
+
+// loadCertPool reads a PEM bundle of CA certificates.
+func loadCertPool(path string) (*x509.CertPool, error) {
+	bundle, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	pool := x509.NewCertPool()
+	if !pool.AppendCertsFromPEM(bundle) {
+		return nil, fmt.Errorf("no PEM certificates found in '%s'", path)
+	}
+	return pool, nil
+}
+
+// anonymous authorization allowing any action, used when callers are not authenticated.
+func anonymous(string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Next()
+	}
+}
+
+// newMutualTLSConfig TLS configuration requiring client certificates signed by the informed CAs.
+func newMutualTLSConfig(reloader *certReloader, clientCAs *x509.CertPool) *tls.Config {
+	tlsConfig := newTLSConfig(reloader)
+	tlsConfig.ClientAuth = tls.RequireAndVerifyClientCert
+	tlsConfig.ClientCAs = clientCAs
+	return tlsConfig
+}
+
+// clientCertAuth middleware to map the verified client certificate subject to a identity. The
+// identity name is used as actor in audit log.
+func clientCertAuth(identities map[string]*ClientIdentity) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		state := c.Request.TLS
+		if state == nil || len(state.VerifiedChains) == 0 || len(state.VerifiedChains[0]) == 0 {
+			c.AbortWithStatusJSON(http.StatusUnauthorized,
+				gin.H{"msg": "verified client certificate is required"})
+			return
+		}
+
+		subject := state.VerifiedChains[0][0].Subject
+		identity, found := identities[subject.CommonName]
+		if !found {
+			logEntry(c.Request.Context()).WithField("subject", subject.String()).
+				Warn("Client certificate subject is not mapped to a identity")
+			c.AbortWithStatusJSON(http.StatusForbidden,
+				gin.H{"msg": fmt.Sprintf("subject '%s' is not mapped to a identity", subject)})
+			return
+		}
+
+		c.Set(identityKey, identity)
+		c.Set(actorKey, identity.Name)
+		c.Set(subjectKey, subject.String())
+		c.Next()
+	}
+}
+
+// authorize middleware to check if the authenticated identity is allowed to perform the action,
+// mutations are logged with the authenticated subject.
+func authorize(action string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value, found := c.Get(identityKey)
+		identity, ok := value.(*ClientIdentity)
+		if !found || !ok {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"msg": "identity is required"})
+			return
+		}
+		if !identity.Allows(action) {
+			c.AbortWithStatusJSON(http.StatusForbidden, gin.H{"msg": fmt.Sprintf(
+				"identity '%s' is not allowed to %s", identity.Name, action)})
+			return
+		}
+		if action != ActionRead {
+			logEntry(c.Request.Context()).WithFields(logrus.Fields{
+				"subject":  c.GetString(subjectKey),
+				"identity": identity.Name,
+				"action":   action,
+				"method":   c.Request.Method,
+				"path":     c.Request.URL.Path,
+			}).Info("Client is authorized")
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,213 @@
+package shorty
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	mtlsCABundle     = "/var/tmp/shorty-test-mtls-ca.crt"
+	mtlsDeployerCert = "/var/tmp/shorty-test-mtls-deployer.crt"
+	mtlsDeployerKey  = "/var/tmp/shorty-test-mtls-deployer.key"
+	mtlsStrangerCert = "/var/tmp/shorty-test-mtls-stranger.crt"
+	mtlsStrangerKey  = "/var/tmp/shorty-test-mtls-stranger.key"
+)
+
+func TestMTLSParseClientIdentities(t *testing.T) {
+	identities, err := ParseClientIdentities(
+		"deploy-bot.acme.com=deployer:create,update; ops.acme.com=ops:create,update,delete,admin;" +
+			"viewer.acme.com=viewer")
+	assert.Nil(t, err)
+	assert.Len(t, identities, 3)
+	assert.Equal(t, &ClientIdentity{Name: "deployer", Actions: []string{ActionCreate, ActionUpdate}},
+		identities["deploy-bot.acme.com"])
+	assert.Equal(t, &ClientIdentity{Name: "viewer", Actions: []string{}}, identities["viewer.acme.com"])
+
+	identities, err = ParseClientIdentities("")
+	assert.Nil(t, err)
+	assert.Len(t, identities, 0)
+
+	for _, value := range []string{"bogus", "=deployer:create", "cn=:create", "cn=deployer:bogus"} {
+		_, err = ParseClientIdentities(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestMTLSClientIdentityAllows(t *testing.T) {
+	identity := &ClientIdentity{Name: "deployer", Actions: []string{ActionCreate}}
+	assert.True(t, identity.Allows(ActionRead))
+	assert.True(t, identity.Allows(ActionCreate))
+	assert.False(t, identity.Allows(ActionDelete))
+	assert.False(t, identity.Allows(ActionAdmin))
+}
+
+func TestMTLSMiddleware(t *testing.T) {
+	identities := map[string]*ClientIdentity{
+		"deploy-bot": {Name: "deployer", Actions: []string{ActionCreate}},
+	}
+	router := gin.New()
+	router.Use(clientCertAuth(identities))
+	router.GET("/read", authorize(ActionRead), func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString(actorKey))
+	})
+	router.POST("/delete", authorize(ActionDelete), func(c *gin.Context) {
+		c.Status(http.StatusOK)
+	})
+
+	withSubject := func(req *http.Request, commonName string) *http.Request {
+		cert := &x509.Certificate{Subject: pkix.Name{CommonName: commonName}}
+		req.TLS = &tls.ConnectionState{VerifiedChains: [][]*x509.Certificate{{cert}}}
+		return req
+	}
+
+	tests := []struct {
+		name       string
+		req        *http.Request
+		statusCode int
+	}{
+		{"without-certificate", httptest.NewRequest("GET", "/read", nil), http.StatusUnauthorized},
+		{"unmapped-subject", withSubject(httptest.NewRequest("GET", "/read", nil), "stranger"),
+			http.StatusForbidden},
+		{"allowed", withSubject(httptest.NewRequest("GET", "/read", nil), "deploy-bot"),
+			http.StatusOK},
+		{"not-allowed", withSubject(httptest.NewRequest("POST", "/delete", nil), "deploy-bot"),
+			http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			res := recorderServeHTTP(router, tt.req)
+			assert.Equal(t, tt.statusCode, res.Code)
+		})
+	}
+
+	res := recorderServeHTTP(router, withSubject(httptest.NewRequest("GET", "/read", nil), "deploy-bot"))
+	assert.Equal(t, "deployer", res.Body.String())
+}
+
+// mtlsClient https client presenting the informed certificate, trusting any server certificate.
+func mtlsClient(t *testing.T, certFile, keyFile string) *http.Client {
+	tlsConfig := &tls.Config{InsecureSkipVerify: true}
+	if certFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		assert.Nil(t, err)
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	return &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+}
+
+func TestMTLSAdminServer(t *testing.T) {
+	writeCertificate(t, "localhost", tlsCertFile, tlsKeyFile)
+	writeCertificate(t, "deploy-bot", mtlsDeployerCert, mtlsDeployerKey)
+	writeCertificate(t, "stranger", mtlsStrangerCert, mtlsStrangerKey)
+
+	var bundle []byte
+	for _, path := range []string{mtlsDeployerCert, mtlsStrangerCert} {
+		pem, err := ioutil.ReadFile(path)
+		assert.Nil(t, err)
+		bundle = append(bundle, pem...)
+	}
+	assert.Nil(t, ioutil.WriteFile(mtlsCABundle, bundle, 0600))
+
+	config := NewConfig()
+	config.Address = "127.0.0.1:8445"
+	config.TLSCert = tlsCertFile
+	config.TLSKey = tlsKeyFile
+	config.AdminAddress = "127.0.0.1:8446"
+	config.PublicURL = "https://sho.rt"
+	config.AdminClientCA = mtlsCABundle
+	config.DatabaseFile = "/var/tmp/shorty-test-mtls.sqlite"
+	config.ClientIdentities = map[string]*ClientIdentity{
+		"deploy-bot": {Name: "deployer", Actions: []string{ActionCreate}},
+	}
+	assert.Nil(t, config.Validate())
+	_ = os.Remove(config.DatabaseFile)
+
+	reloader, err := newCertReloader(tlsCertFile, tlsKeyFile)
+	assert.Nil(t, err)
+	clientCAs, err := loadCertPool(config.AdminClientCA)
+	assert.Nil(t, err)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	s := &Shorty{
+		config:       config,
+		engine:       gin.New(),
+		adminEngine:  gin.New(),
+		clientCAs:    clientCAs,
+		handler:      NewHandler(p),
+		persistence:  p,
+		stopChan:     make(chan os.Signal, 1),
+		certReloader: reloader,
+		done:         make(chan struct{}),
+		workers:      &sync.WaitGroup{},
+	}
+	s.setUpRoutes()
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- s.httpServer()
+	}()
+	time.Sleep(time.Second)
+
+	adminURL := fmt.Sprintf("https://%s/shorty/%s", config.AdminAddress, short)
+	body := fmt.Sprintf(`{"url":"%s"}`, longURL)
+
+	t.Log("Clients without certificate must be refused on handshake")
+	_, err = mtlsClient(t, "", "").Post(adminURL, "application/json", strings.NewReader(body))
+	assert.Error(t, err)
+
+	t.Log("Public listener must not serve the management API, bypassing client certificates")
+	publicURL := fmt.Sprintf("https://%s/shorty/%s", config.Address, short)
+	res, err := mtlsClient(t, "", "").Post(publicURL, "application/json", strings.NewReader(body))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+	res, err = mtlsClient(t, "", "").Get(fmt.Sprintf("https://%s/shorty/", config.Address))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+
+	t.Log("Subjects not mapped to a identity must be forbidden")
+	res, err = mtlsClient(t, mtlsStrangerCert, mtlsStrangerKey).
+		Post(adminURL, "application/json", strings.NewReader(body))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	deployer := mtlsClient(t, mtlsDeployerCert, mtlsDeployerKey)
+	res, err = deployer.Post(adminURL, "application/json", strings.NewReader(body))
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+
+	req, err := http.NewRequest("DELETE", adminURL, nil)
+	assert.Nil(t, err)
+	res, err = deployer.Do(req)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	res, err = deployer.Post(fmt.Sprintf("https://%s/admin/backup", config.AdminAddress), "", nil)
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+
+	t.Log("Identity name must be recorded as actor")
+	entries, err := p.History(context.Background(), short)
+	assert.Nil(t, err)
+	assert.Len(t, entries, 1)
+	assert.Equal(t, "deployer", entries[0].Actor)
+
+	s.Shutdown()
+	assert.Nil(t, <-serverErr)
+}
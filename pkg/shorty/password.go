@@ -0,0 +1,214 @@
+package shorty
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// passwordHeader header carrying the password of protected links, informed by API clients.
+	passwordHeader = "X-Shorty-Password"
+	// passwordField form field carrying the password, submitted by the password prompt.
+	passwordField = "password"
+	// maxPasswordLength bcrypt only takes the first 72 bytes into account.
+	maxPasswordLength = 72
+	// defaultPasswordMaxAttempts failed attempts allowed per link, before locking it.
+	defaultPasswordMaxAttempts = 5
+	// defaultPasswordLockout seconds failed attempts are accounted for, and a link stays locked.
+	defaultPasswordLockout = 900
+)
+
+// passwordTemplate password prompt of protected links, submitted to the unlock endpoint.
+var passwordTemplate = template.Must(template.Must(pageLayout.Clone()).Parse(`
+{{define "content"}}
+  <p>The short link <strong>{{.Short}}</strong> is protected by password.</p>
+  {{with .Msg}}<p class="error">{{.}}</p>{{end}}
+  <form method="post" action="{{.Action}}">
+    <input name="password" type="password" required autofocus autocomplete="current-password">
+    <button class="continue" type="submit">Continue</button>
+  </form>
+{{end}}`))
+
+// hashPassword replaces the informed password by its bcrypt hash, entries without password are
+// kept as is.
+func (s *Shortened) hashPassword() error {
+	if s.Password == "" {
+		return nil
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(s.Password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	s.Password = ""
+	s.PasswordHash = string(hash)
+	s.Protected = true
+	return nil
+}
+
+// validatePassword check if the informed password can be hashed without being truncated.
+func validatePassword(password string) error {
+	if len(password) > maxPasswordLength {
+		return reject(rejectLongPassword, "passwords can't be longer than %d bytes",
+			maxPasswordLength)
+	}
+	return nil
+}
+
+// concealProtected removes the URL of protected entries, shown to callers not allowed to reveal them.
+func concealProtected(slice []*Shortened) {
+	for _, s := range slice {
+		if s.Protected {
+			s.URL = ""
+		}
+	}
+}
+
+// validatePasswordHash check if the password hash, informed on import, is a bcrypt hash. Empty
+// means the entry is not protected.
+func validatePasswordHash(hash string) error {
+	if hash == "" {
+		return nil
+	}
+	_, err := bcrypt.Cost([]byte(hash))
+	return err
+}
+
+// attempts password attempts of a link, accounted since the first one.
+type attempts struct {
+	count int       // amount of attempts
+	since time.Time // first attempt
+}
+
+// attemptLimiter accounts password attempts per link, locking links reaching the maximum amount
+// of attempts until the lockout period, started on the first attempt, is over. Successful attempts
+// reset the account, so only failures lock a link.
+type attemptLimiter struct {
+	m        sync.Mutex
+	max      int                  // attempts allowed per lockout period
+	lockout  time.Duration        // period attempts are accounted for
+	attempts map[string]*attempts // attempts by short string
+	now      func() time.Time     // current time, replaced on tests
+}
+
+// expired checks if the lockout period of the attempts is over.
+func (a *attemptLimiter) expired(at *attempts) bool {
+	return !a.now().Before(at.since.Add(a.lockout))
+}
+
+// attempt accounts a attempt on the link, before checking the password, so concurrent attempts
+// can't exceed the maximum. When the link is locked, returns false and the remaining lockout time.
+// Expired attempts of other links are dropped meanwhile.
+func (a *attemptLimiter) attempt(short string) (time.Duration, bool) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	for other, at := range a.attempts {
+		if a.expired(at) {
+			delete(a.attempts, other)
+		}
+	}
+	at, found := a.attempts[short]
+	if !found {
+		a.attempts[short] = &attempts{count: 1, since: a.now()}
+		return 0, true
+	}
+	if at.count >= a.max {
+		return at.since.Add(a.lockout).Sub(a.now()), false
+	}
+	at.count++
+	return 0, true
+}
+
+// reset forgets attempts on the link, after a successful attempt.
+func (a *attemptLimiter) reset(short string) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	delete(a.attempts, short)
+}
+
+// setLimits replaces the maximum amount of attempts and the lockout period, applied to attempts
+// already accounted as well.
+func (a *attemptLimiter) setLimits(max int, lockout time.Duration) {
+	a.m.Lock()
+	defer a.m.Unlock()
+
+	a.max = max
+	a.lockout = lockout
+}
+
+// newAttemptLimiter instantiate a limiter allowing max failed attempts per lockout period.
+func newAttemptLimiter(max int, lockout time.Duration) *attemptLimiter {
+	return &attemptLimiter{
+		max:      max,
+		lockout:  lockout,
+		attempts: map[string]*attempts{},
+		now:      time.Now,
+	}
+}
+
+// informedPassword password informed via header, or submitted on a form.
+func informedPassword(c *gin.Context) string {
+	if c.Request.Method == http.MethodPost {
+		return c.PostForm(passwordField)
+	}
+	return c.GetHeader(passwordHeader)
+}
+
+// unlock checks the password informed for a protected entry, via header or the prompt form. When
+// not informed or incorrect, responds with the prompt, or a error for JSON clients, and returns
+// false. Links reaching the maximum amount of failed attempts are locked for a while.
+func (h *Handler) unlock(c *gin.Context, shortened *Shortened) bool {
+	ctx := c.Request.Context()
+	password := informedPassword(c)
+	if password == "" {
+		annotateSpan(ctx, shortened.Short, outcomeProtected)
+		h.prompt(c, http.StatusUnauthorized, "")
+		return false
+	}
+
+	if wait, allowed := h.attempts.attempt(shortened.Short); !allowed {
+		annotateSpan(ctx, shortened.Short, outcomeLocked)
+		logEntry(ctx).WithField("short", shortened.Short).Warn("Password attempts are locked")
+		c.Header("Retry-After", strconv.Itoa(int(wait.Seconds()+0.5)))
+		h.prompt(c, http.StatusTooManyRequests, "too many failed attempts, try again later")
+		return false
+	}
+	err := bcrypt.CompareHashAndPassword([]byte(shortened.PasswordHash), []byte(password))
+	if err != nil {
+		annotateSpan(ctx, shortened.Short, outcomeProtected)
+		logEntry(ctx).WithField("short", shortened.Short).Info("Incorrect password informed")
+		h.prompt(c, http.StatusUnauthorized, "incorrect password")
+		return false
+	}
+	h.attempts.reset(shortened.Short)
+	return true
+}
+
+// prompt responds with the password prompt showing the error message, when informed, or the
+// message for JSON clients.
+func (h *Handler) prompt(c *gin.Context, status int, msg string) {
+	c.Header("Cache-Control", "no-store")
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		if msg == "" {
+			msg = "short link is protected by password"
+		}
+		c.AbortWithStatusJSON(status, gin.H{"msg": msg})
+		return
+	}
+	short := c.Param("short")
+	renderPage(c, status, passwordTemplate, gin.H{
+		"Short":  short,
+		"Msg":    msg,
+		"Action": fmt.Sprintf("/shorty/%s/unlock", url.PathEscape(short)),
+	})
+	c.Abort()
+}
@@ -0,0 +1,191 @@
+package shorty
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPasswordAttemptLimiter(t *testing.T) {
+	now := time.Unix(0, 0)
+	a := newAttemptLimiter(2, time.Minute)
+	a.now = func() time.Time { return now }
+
+	for i := 0; i < 2; i++ {
+		_, allowed := a.attempt(short)
+		assert.True(t, allowed)
+	}
+	now = now.Add(20 * time.Second)
+	wait, allowed := a.attempt(short)
+	assert.False(t, allowed)
+	assert.Equal(t, 40*time.Second, wait)
+	_, allowed = a.attempt("other")
+	assert.True(t, allowed)
+
+	t.Log("Lockout is over after the period started on the first attempt")
+	now = now.Add(40 * time.Second)
+	_, allowed = a.attempt(short)
+	assert.True(t, allowed)
+
+	t.Log("Successful attempts reset the account")
+	a.reset(short)
+	for i := 0; i < 2; i++ {
+		_, allowed = a.attempt(short)
+		assert.True(t, allowed)
+	}
+
+	t.Log("Expired attempts of other links are dropped")
+	now = now.Add(time.Minute)
+	_, allowed = a.attempt(short)
+	assert.True(t, allowed)
+	assert.Len(t, a.attempts, 1)
+}
+
+func TestPasswordHashPassword(t *testing.T) {
+	s := &Shortened{Short: short, URL: longURL}
+	assert.Nil(t, s.hashPassword())
+	assert.False(t, s.Protected)
+
+	s.Password = "secret"
+	assert.Nil(t, s.hashPassword())
+	assert.True(t, s.Protected)
+	assert.Empty(t, s.Password)
+	assert.True(t, strings.HasPrefix(s.PasswordHash, "$2a$"))
+
+	assert.Nil(t, validatePassword(strings.Repeat("x", maxPasswordLength)))
+	assert.NotNil(t, validatePassword(strings.Repeat("x", maxPasswordLength+1)))
+}
+
+func TestPasswordHandler(t *testing.T) {
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-password.sqlite"
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	h := NewHandler(p)
+	h.attempts = newAttemptLimiter(2, time.Minute)
+	h.attempts.now = func() time.Time { return time.Unix(0, 0) }
+	router := gin.New()
+	router.POST("/shorty/:short", h.Create)
+	router.GET("/shorty/:short", h.Read)
+	router.POST("/shorty/:short/unlock", h.Read)
+	get := func(path, accept, password string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		if password != "" {
+			req.Header.Set(passwordHeader, password)
+		}
+		return recorderServeHTTP(router, req)
+	}
+	unlock := func(short, password string) *httptest.ResponseRecorder {
+		form := url.Values{passwordField: {password}}.Encode()
+		req := httptest.NewRequest("POST", "/shorty/"+short+"/unlock", strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return recorderServeHTTP(router, req)
+	}
+
+	t.Log("Password is hashed on create, and never shown")
+	req := httptest.NewRequest("POST", "/shorty/abc",
+		strings.NewReader(`{"url":"http://x.y.z","password":"secret"}`))
+	rr := recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "secret")
+	stored, err := p.Read(req.Context(), short)
+	assert.Nil(t, err)
+	assert.True(t, stored.Protected)
+	assert.NotEqual(t, "secret", stored.PasswordHash)
+
+	t.Log("Password is prompted when not informed")
+	rr = get("/shorty/abc", "text/html", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), `action="/shorty/abc/unlock"`)
+	assert.NotContains(t, rr.Body.String(), longURL)
+	rr = get("/shorty/abc+", "application/json", "")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.NotContains(t, rr.Body.String(), longURL)
+
+	t.Log("Correct password is accepted via header and form")
+	rr = get("/shorty/abc", "application/json", "secret")
+	assert.Equal(t, http.StatusTemporaryRedirect, rr.Code)
+	assert.Equal(t, longURL, rr.Header().Get("Location"))
+	var shortened Shortened
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &shortened))
+	assert.True(t, shortened.Protected)
+	rr = unlock(short, "secret")
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+	assert.Equal(t, longURL, rr.Header().Get("Location"))
+
+	t.Log("Failed attempts lock the link, even for the correct password")
+	rr = unlock(short, "wrong")
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), "incorrect password")
+	assert.Equal(t, http.StatusUnauthorized, get("/shorty/abc", "application/json", "wrong").Code)
+	rr = get("/shorty/abc", "application/json", "secret")
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "60", rr.Header().Get("Retry-After"))
+
+	req = httptest.NewRequest("POST", "/shorty/long", strings.NewReader(
+		`{"url":"http://x.y.z","password":"`+strings.Repeat("x", maxPasswordLength+1)+`"}`))
+	assert.Equal(t, http.StatusBadRequest, recorderServeHTTP(router, req).Code)
+}
+
+func TestPasswordConcealedOnListing(t *testing.T) {
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-password-list.sqlite"
+	config.AdminToken = "token"
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	protected := &Shortened{Short: "protected", URL: "http://secret.internal/doc", Password: "pw"}
+	assert.Nil(t, protected.hashPassword())
+	for _, s := range []*Shortened{protected, {Short: "open", URL: longURL}} {
+		assert.Nil(t, p.Write(context.Background(), s))
+	}
+
+	s := &Shorty{config: config, engine: gin.New(), handler: NewHandler(p), persistence: p}
+	s.setUpRoutes()
+	list := func(path, authorization string) []*Shortened {
+		req := httptest.NewRequest("GET", path, nil)
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rr := recorderServeHTTP(s.engine, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		slice := []*Shortened{}
+		assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &slice))
+		return slice
+	}
+
+	t.Log("URLs of protected entries must be concealed, and not searched, for anonymous callers")
+	for _, authorization := range []string{"", "Bearer bogus"} {
+		slice := list("/shorty/?limit=10", authorization)
+		assert.Len(t, slice, 2)
+		assert.Equal(t, longURL, slice[0].URL)
+		assert.Equal(t, "", slice[1].URL)
+		assert.True(t, slice[1].Protected)
+		assert.Len(t, list("/shorty/?limit=10&q=secret.internal", authorization), 0)
+		assert.Equal(t, "", list("/shorty/", authorization)[0].URL)
+	}
+
+	t.Log("Administrators must see and search URLs of protected entries")
+	slice := list("/shorty/?limit=10&q=secret.internal", "Bearer token")
+	assert.Len(t, slice, 1)
+	assert.Equal(t, protected.URL, slice[0].URL)
+
+	t.Log("Administrators must see URLs of deleted protected entries on trash")
+	assert.Nil(t, p.Delete(context.Background(), protected.Short))
+	assert.Equal(t, protected.URL, list("/shorty/_trash", "Bearer token")[0].URL)
+}
@@ -4,58 +4,212 @@ import (
 	"context"
 	"database/sql"
 	"fmt"
-	"log"
+	"io"
+	"strconv"
 	"strings"
 	"sync"
+	"time"
 
-	"contrib.go.opencensus.io/integrations/ocsql"
-	_ "github.com/mattn/go-sqlite3" // sqlite driver
+	"github.com/mattn/go-sqlite3"
+	"github.com/sirupsen/logrus"
 )
 
+// migration represents a set of statements to evolve database schema.
+type migration struct {
+	description string   // short description, for logging
+	statements  []string // statements executed in a single transaction
+}
+
+// migrations ordered list of schema migrations, the position in slice is the schema version.
+var migrations = []migration{
+	{
+		description: "create shorty table",
+		statements: []string{`
+CREATE TABLE IF NOT EXISTS shorty (
+	short  		TEXT NOT NULL,
+	url 	    TEXT NOT NULL,
+	created_at 	INTEGER NOT NULL,
+	PRIMARY KEY (short)
+)`},
+	},
+	{
+		description: "add deleted_at column for soft delete",
+		statements: []string{
+			"ALTER TABLE shorty ADD COLUMN deleted_at INTEGER NOT NULL DEFAULT 0",
+			"CREATE INDEX shorty_deleted_at ON shorty (deleted_at)",
+		},
+	},
+	{
+		description: "create append-only audit table",
+		statements: []string{`
+CREATE TABLE audit (
+	id          INTEGER PRIMARY KEY AUTOINCREMENT,
+	short       TEXT NOT NULL,
+	action      TEXT NOT NULL,
+	actor       TEXT NOT NULL,
+	source_ip   TEXT NOT NULL,
+	old_url     TEXT NOT NULL,
+	new_url     TEXT NOT NULL,
+	created_at  INTEGER NOT NULL
+)`,
+			"CREATE INDEX audit_short ON audit (short)",
+			"CREATE INDEX audit_created_at ON audit (created_at)",
+			`
+CREATE TRIGGER audit_no_update BEFORE UPDATE ON audit
+BEGIN
+	SELECT RAISE(ABORT, 'audit log is append-only');
+END`,
+			`
+CREATE TRIGGER audit_no_delete BEFORE DELETE ON audit
+BEGIN
+	SELECT RAISE(ABORT, 'audit log is append-only');
+END`,
+		},
+	},
+	{
+		description: "add preview column",
+		statements: []string{
+			"ALTER TABLE shorty ADD COLUMN preview INTEGER NOT NULL DEFAULT 0",
+		},
+	},
+	{
+		description: "add password hash column",
+		statements: []string{
+			"ALTER TABLE shorty ADD COLUMN password_hash TEXT NOT NULL DEFAULT ''",
+		},
+	},
+	{
+		description: "add max_clicks and clicks columns",
+		statements: []string{
+			"ALTER TABLE shorty ADD COLUMN max_clicks INTEGER NOT NULL DEFAULT 0",
+			"ALTER TABLE shorty ADD COLUMN clicks INTEGER NOT NULL DEFAULT 0",
+		},
+	},
+	{
+		description: "add changes column to audit table",
+		statements: []string{
+			"ALTER TABLE audit ADD COLUMN changes TEXT NOT NULL DEFAULT ''",
+		},
+	},
+}
+
+// Strategies when importing a entry whose short string is already stored.
+const (
+	OnConflictSkip      = "skip"      // keep stored entry
+	OnConflictOverwrite = "overwrite" // replace stored entry
+	OnConflictFail      = "fail"      // abort import, nothing is stored
+)
+
+// ImportStats accounts the outcome of a import.
+type ImportStats struct {
+	Imported int // entries stored
+	Skipped  int // entries skipped due to conflict
+	Invalid  int // entries not passing validation
+}
+
+// caseInsensitiveIndexName unique index comparing short strings without case.
+const caseInsensitiveIndexName = "shorty_short_nocase"
+
+// shortenedColumns columns needed to compose a Shortened instance, in the order expected by scan.
+const shortenedColumns = "short, url, created_at, deleted_at, preview, password_hash, " +
+	"max_clicks, clicks"
+
+// insertQuery stores a new entry, using the arguments returned by insertArgs.
+const insertQuery = `
+INSERT INTO shorty(short, url, created_at, preview, password_hash, max_clicks, clicks)
+VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+// insertArgs arguments of insertQuery for the entry.
+func insertArgs(s *Shortened) []interface{} {
+	return []interface{}{
+		s.Short, s.URL, s.CreatedAt, s.Preview, s.PasswordHash, s.MaxClicks, s.Clicks,
+	}
+}
+
+// likeEscaper escapes wildcards of LIKE patterns, using backslash as escape character.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`)
+
+// scanner common interface of sql.Row and sql.Rows.
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scan reads a Shortened instance out of a row selecting shortenedColumns.
+func scan(row scanner) (*Shortened, error) {
+	s := &Shortened{}
+	err := row.Scan(&s.Short, &s.URL, &s.CreatedAt, &s.DeletedAt, &s.Preview, &s.PasswordHash,
+		&s.MaxClicks, &s.Clicks)
+	if err != nil {
+		return nil, err
+	}
+	s.Protected = s.PasswordHash != ""
+	return s, nil
+}
+
 // Persistence represents the database backend.
 type Persistence struct {
-	config *Config
-	mu     *sync.Mutex
-	db     *sql.DB
+	config  *Config
+	mu      *sync.Mutex
+	db      *sql.DB
+	connStr string          // database connection string
+	metrics *storageMetrics // storage operations latency
 }
 
 // Write creates a new entry in the database.
 func (p *Persistence) Write(ctx context.Context, s *Shortened) error {
-	var tx *sql.Tx
-	var stmt *sql.Stmt
-	var err error
+	defer p.metrics.measure(ctx, "write")()
 
-	p.mu.Lock()
-	defer p.mu.Unlock()
+	return p.transaction(ctx, func(tx *sql.Tx) error {
+		if _, err := tx.ExecContext(ctx, insertQuery, insertArgs(s)...); err != nil {
+			return err
+		}
+		return p.audit(ctx, tx, AuditCreate, s.Short, "", s.URL)
+	})
+}
 
-	query := `
-INSERT INTO shorty(short, url, created_at)
-VALUES (?, ?, ?)`
+// WriteBulk creates entries in a single transaction, a failure on a given entry does not prevent
+// the others to be stored. Returns a error per entry, in the same order, or a error when the
+// transaction itself fails.
+func (p *Persistence) WriteBulk(ctx context.Context, slice []*Shortened) ([]error, error) {
+	defer p.metrics.measure(ctx, "write_bulk")()
 
-	if tx, err = p.db.Begin(); err != nil {
-		return err
-	}
-	if stmt, err = tx.PrepareContext(ctx, query); err != nil {
-		return err
-	}
-	defer stmt.Close()
+	errs := make([]error, len(slice))
+	err := p.transaction(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, insertQuery)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
 
-	if _, err = stmt.ExecContext(ctx, s.Short, s.URL, s.CreatedAt); err != nil {
-		_ = tx.Rollback()
-		return err
+		// a constraint violation only aborts the statement, the transaction carries on
+		for i, s := range slice {
+			if _, errs[i] = stmt.ExecContext(ctx, insertArgs(s)...); errs[i] != nil {
+				continue
+			}
+			if err = p.audit(ctx, tx, AuditCreate, s.Short, "", s.URL); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
 	}
-	return tx.Commit()
+	return errs, nil
 }
 
-// Read database entry based on its short string, unique in the database.
+// Read database entry based on its short string, unique in the database. Deleted entries are
+// returned as well, carrying deletion timestamp.
 func (p *Persistence) Read(ctx context.Context, short string) (*Shortened, error) {
+	defer p.metrics.measure(ctx, "read")()
+
 	var rows *sql.Rows
 	var err error
 
-	query := `
-SELECT short, url, created_at
+	query := fmt.Sprintf(`
+SELECT %s
 FROM shorty
-WHERE short = ?`
+WHERE %s`, shortenedColumns, p.shortMatch())
 
 	if rows, err = p.db.QueryContext(ctx, query, short); err != nil {
 		return nil, err
@@ -65,52 +219,518 @@ WHERE short = ?`
 		return nil, sql.ErrNoRows
 	}
 
-	s := &Shortened{}
-	if err = rows.Scan(&s.Short, &s.URL, &s.CreatedAt); err != nil {
+	return scan(rows)
+}
+
+// List returns all entries, except deleted.
+func (p *Persistence) List(ctx context.Context) ([]*Shortened, error) {
+	defer p.metrics.measure(ctx, "list")()
+
+	query := fmt.Sprintf(`
+SELECT %s
+  FROM shorty
+ WHERE deleted_at = 0`, shortenedColumns)
+	return p.query(ctx, query)
+}
+
+// Page returns up to limit entries, except deleted, ordered by short string and starting after the
+// informed short string, empty starts from the first entry. When search is informed, only entries
+// containing it in short string or URL are returned, ignoring case. URLs of protected entries are
+// only searched when informed, so their URLs can't be guessed by searching.
+func (p *Persistence) Page(
+	ctx context.Context,
+	after string,
+	search string,
+	limit int,
+	searchProtected bool,
+) ([]*Shortened, error) {
+	defer p.metrics.measure(ctx, "page")()
+
+	query := fmt.Sprintf(`
+SELECT %s
+  FROM shorty
+ WHERE deleted_at = 0 AND short > ?
+   AND (short LIKE ? ESCAPE '\'
+        OR (url LIKE ? ESCAPE '\' AND (? OR password_hash = '')))
+ ORDER BY short
+ LIMIT ?`, shortenedColumns)
+	pattern := fmt.Sprintf("%%%s%%", likeEscaper.Replace(search))
+	return p.query(ctx, query, after, pattern, pattern, searchProtected, limit)
+}
+
+// Count returns the amount of entries, except deleted.
+func (p *Persistence) Count(ctx context.Context) (int64, error) {
+	defer p.metrics.measure(ctx, "count")()
+
+	var total int64
+	err := p.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM shorty WHERE deleted_at = 0").Scan(&total)
+	return total, err
+}
+
+// Trash returns deleted entries, most recently deleted first.
+func (p *Persistence) Trash(ctx context.Context) ([]*Shortened, error) {
+	defer p.metrics.measure(ctx, "trash")()
+
+	query := fmt.Sprintf(`
+SELECT %s
+  FROM shorty
+ WHERE deleted_at > 0
+ ORDER BY deleted_at DESC`, shortenedColumns)
+	return p.query(ctx, query)
+}
+
+// query executes the query and scan all resulting rows.
+func (p *Persistence) query(ctx context.Context, query string, args ...interface{}) ([]*Shortened, error) {
+	rows, err := p.db.QueryContext(ctx, query, args...)
+	if err != nil {
 		return nil, err
 	}
+	defer rows.Close()
 
-	return s, nil
+	slice := []*Shortened{}
+	for rows.Next() {
+		s, err := scan(rows)
+		if err != nil {
+			return nil, err
+		}
+		slice = append(slice, s)
+	}
+	return slice, rows.Err()
 }
 
-// List returns all entries.
-func (p *Persistence) List(ctx context.Context) ([]*Shortened, error) {
-	query := `
-SELECT short, url, created_at
-  FROM shorty`
+// Each iterates over all entries, except deleted, ordered by creation time, without loading them
+// all in memory. Iteration stops on the first error returned by informed function.
+func (p *Persistence) Each(ctx context.Context, fn func(*Shortened) error) error {
+	defer p.metrics.measure(ctx, "each")()
+
+	query := fmt.Sprintf(`
+SELECT %s
+  FROM shorty
+ WHERE deleted_at = 0
+ ORDER BY created_at, short`, shortenedColumns)
 	rows, err := p.db.QueryContext(ctx, query)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		s, err := scan(rows)
+		if err != nil {
+			return err
+		}
+		if err = fn(s); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
+
+// Update replaces the URL of a entry, and the preview flag when informed, deleted entries can't be
+// updated. Changing the preview flag is recorded in audit log as well. Returns sql.ErrNoRows when
+// entry is not found.
+func (p *Persistence) Update(ctx context.Context, short, longURL string, preview *bool) error {
+	defer p.metrics.measure(ctx, "update")()
+
+	return p.transaction(ctx, func(tx *sql.Tx) error {
+		stored, oldURL, err := p.lookup(ctx, tx, short, "deleted_at = 0")
+		if err != nil {
+			return err
+		}
+		changes := []*AuditChange{}
+		if preview != nil {
+			var oldPreview bool
+			query := "SELECT preview FROM shorty WHERE short = ?"
+			if err = tx.QueryRowContext(ctx, query, stored).Scan(&oldPreview); err != nil {
+				return err
+			}
+			if oldPreview != *preview {
+				changes = append(changes, &AuditChange{Field: "preview",
+					Old: strconv.FormatBool(oldPreview), New: strconv.FormatBool(*preview)})
+			}
+		}
+		query := "UPDATE shorty SET url = ?, preview = COALESCE(?, preview) WHERE short = ?"
+		if _, err = tx.ExecContext(ctx, query, longURL, preview, stored); err != nil {
+			return err
+		}
+		return p.audit(ctx, tx, AuditUpdate, stored, oldURL, longURL, changes...)
+	})
+}
+
+// Click accounts a click on a entry limited by maximum clicks, incrementing and checking the
+// counter in a single statement, so concurrent clicks can't exceed the limit. Returns
+// sql.ErrNoRows when entry is not found, deleted, or has no clicks left.
+func (p *Persistence) Click(ctx context.Context, short string) error {
+	defer p.metrics.measure(ctx, "click")()
+
+	query := fmt.Sprintf(`
+UPDATE shorty
+   SET clicks = clicks + 1
+ WHERE %s
+   AND deleted_at = 0
+   AND max_clicks > 0
+   AND clicks < max_clicks`, p.shortMatch())
+	return p.transaction(ctx, func(tx *sql.Tx) error {
+		res, err := tx.ExecContext(ctx, query, short)
+		if err != nil {
+			return err
+		}
+		affected, err := res.RowsAffected()
+		if err != nil {
+			return err
+		}
+		if affected == 0 {
+			return sql.ErrNoRows
+		}
+		return nil
+	})
+}
+
+// Delete marks the entry as deleted, the entry is kept in trash until purged. Returns
+// sql.ErrNoRows when entry is not found, or already deleted.
+func (p *Persistence) Delete(ctx context.Context, short string) error {
+	defer p.metrics.measure(ctx, "delete")()
+
+	return p.transaction(ctx, func(tx *sql.Tx) error {
+		stored, oldURL, err := p.lookup(ctx, tx, short, "deleted_at = 0")
+		if err != nil {
+			return err
+		}
+		query := "UPDATE shorty SET deleted_at = ? WHERE short = ?"
+		if _, err = tx.ExecContext(ctx, query, time.Now().Unix(), stored); err != nil {
+			return err
+		}
+		return p.audit(ctx, tx, AuditDelete, stored, oldURL, "")
+	})
+}
+
+// Undelete brings back a deleted entry. Returns sql.ErrNoRows when entry is not found in trash.
+func (p *Persistence) Undelete(ctx context.Context, short string) error {
+	defer p.metrics.measure(ctx, "undelete")()
+
+	return p.transaction(ctx, func(tx *sql.Tx) error {
+		stored, longURL, err := p.lookup(ctx, tx, short, "deleted_at > 0")
+		if err != nil {
+			return err
+		}
+		query := "UPDATE shorty SET deleted_at = 0 WHERE short = ?"
+		if _, err = tx.ExecContext(ctx, query, stored); err != nil {
+			return err
+		}
+		return p.audit(ctx, tx, AuditRestore, stored, "", longURL)
+	})
+}
+
+// Purge permanently removes entries deleted before informed timestamp, returns the amount of
+// entries removed.
+func (p *Persistence) Purge(ctx context.Context, before int64) (int64, error) {
+	defer p.metrics.measure(ctx, "purge")()
+
+	var purged int64
+	err := p.transaction(ctx, func(tx *sql.Tx) error {
+		rows, err := tx.QueryContext(ctx, `
+SELECT short, url
+  FROM shorty
+ WHERE deleted_at > 0 AND deleted_at < ?`, before)
+		if err != nil {
+			return err
+		}
+		purgeable := []*Shortened{}
+		for rows.Next() {
+			s := &Shortened{}
+			if err = rows.Scan(&s.Short, &s.URL); err != nil {
+				rows.Close()
+				return err
+			}
+			purgeable = append(purgeable, s)
+		}
+		rows.Close()
+
+		for _, s := range purgeable {
+			if _, err = tx.ExecContext(ctx, "DELETE FROM shorty WHERE short = ?", s.Short); err != nil {
+				return err
+			}
+			if err = p.audit(ctx, tx, AuditPurge, s.Short, s.URL, ""); err != nil {
+				return err
+			}
+		}
+		purged = int64(len(purgeable))
+		return nil
+	})
+	return purged, err
+}
+
+// lookup finds the stored short string and URL of a entry matching the extra condition, within
+// the transaction. Returns sql.ErrNoRows when not found.
+func (p *Persistence) lookup(ctx context.Context, tx *sql.Tx, short, condition string) (string, string, error) {
+	var stored, longURL string
+	query := fmt.Sprintf(`
+SELECT short, url
+  FROM shorty
+ WHERE %s AND %s`, condition, p.shortMatch())
+	err := tx.QueryRowContext(ctx, query, short).Scan(&stored, &longURL)
+	return stored, longURL, err
+}
+
+// transaction executes function within a transaction, committed when function is successful and
+// rolled back otherwise.
+func (p *Persistence) transaction(ctx context.Context, fn func(*sql.Tx) error) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	tx, err := p.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	if err = fn(tx); err != nil {
+		_ = tx.Rollback()
+		return err
+	}
+	return tx.Commit()
+}
+
+// shortMatch where clause to match short string, respecting case-insensitive mode.
+func (p *Persistence) shortMatch() string {
+	if p.config.CaseInsensitive {
+		return "short = ? COLLATE NOCASE"
+	}
+	return "short = ?"
+}
+
+// Import stores all entries read from decoder in a single transaction, handling existing short
+// strings according to informed strategy. Entries without creation time are stamped with current
+// time, and entries carrying a password hash which is not bcrypt are invalid.
+func (p *Persistence) Import(ctx context.Context, dec Decoder, onConflict string) (*ImportStats, error) {
+	query := insertQuery
+	switch onConflict {
+	case OnConflictSkip, OnConflictFail:
+	case OnConflictOverwrite:
+		query = strings.Replace(query, "INSERT", "INSERT OR REPLACE", 1)
+	default:
+		return nil, fmt.Errorf("unsupported on-conflict strategy '%s'", onConflict)
+	}
+
+	stats := &ImportStats{}
+	err := p.transaction(ctx, func(tx *sql.Tx) error {
+		stmt, err := tx.PrepareContext(ctx, query)
+		if err != nil {
+			return err
+		}
+		defer stmt.Close()
+
+		for {
+			s := &Shortened{}
+			if err = dec.Decode(s); err == io.EOF {
+				return nil
+			} else if err != nil {
+				return err
+			}
+
+			if err = validateShort(s.Short); err != nil || s.URL == "" ||
+				validatePassword(s.Password) != nil || validatePasswordHash(s.PasswordHash) != nil ||
+				validateMaxClicks(s.MaxClicks) != nil {
+				logEntry(ctx).WithFields(logrus.Fields{"short": s.Short, "url": s.URL}).
+					Warn("Skipping invalid entry")
+				stats.Invalid++
+				continue
+			}
+			if s.CreatedAt == 0 {
+				s.CreatedAt = time.Now().Unix()
+			}
+			if err = s.hashPassword(); err != nil {
+				return err
+			}
+
+			// recording the replaced URL in audit log, when overwriting
+			var oldURL string
+			if onConflict == OnConflictOverwrite {
+				if _, oldURL, err = p.lookup(ctx, tx, s.Short, "deleted_at >= 0"); err != nil &&
+					!p.IsErrNoRows(err) {
+					return err
+				}
+			}
+
+			if _, err = stmt.ExecContext(ctx, insertArgs(s)...); err != nil {
+				if !p.IsErrUniqueConstraint(err) || onConflict == OnConflictFail {
+					return fmt.Errorf("on storing short '%s': %s", s.Short, err)
+				}
+				stats.Skipped++
+				continue
+			}
+			if err = p.audit(ctx, tx, AuditImport, s.Short, oldURL, s.URL); err != nil {
+				return err
+			}
+			stats.Imported++
+		}
+	})
+	if err != nil {
+		return nil, err
+	}
+	return stats, nil
+}
+
+// schemaVersion returns the current schema version, stored as SQLite "user_version" pragma.
+func (p *Persistence) schemaVersion() (int, error) {
+	var version int
+	if err := p.db.QueryRow("PRAGMA user_version").Scan(&version); err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// migrate apply pending schema migrations, each one in its own transaction. The schema version is
+// bumped together with the migration statements.
+func (p *Persistence) migrate() error {
+	version, err := p.schemaVersion()
+	if err != nil {
+		return err
+	}
+	for i := version; i < len(migrations); i++ {
+		m := migrations[i]
+		logger.WithField("version", i+1).Infof("Applying migration: %s", m.description)
+
+		tx, err := p.db.Begin()
+		if err != nil {
+			return err
+		}
+		for _, stmt := range m.statements {
+			if _, err = tx.Exec(stmt); err != nil {
+				_ = tx.Rollback()
+				return fmt.Errorf("migration '%d' failed: %s", i+1, err)
+			}
+		}
+		// pragma does not accept bind parameters
+		if _, err = tx.Exec(fmt.Sprintf("PRAGMA user_version = %d", i+1)); err != nil {
+			_ = tx.Rollback()
+			return err
+		}
+		if err = tx.Commit(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Ping checks the database connection is alive.
+func (p *Persistence) Ping(ctx context.Context) error {
+	return p.db.PingContext(ctx)
+}
+
+// Migrated checks all schema migrations known by the application are applied.
+func (p *Persistence) Migrated(ctx context.Context) error {
+	var version int
+	if err := p.db.QueryRowContext(ctx, "PRAGMA user_version").Scan(&version); err != nil {
+		return err
+	}
+	if version != len(migrations) {
+		return fmt.Errorf("schema version is '%d', expected '%d'", version, len(migrations))
+	}
+	return nil
+}
+
+// caseInsensitiveCollisions returns the short strings that would collide when compared without
+// case, grouped by their lower case representation.
+func (p *Persistence) caseInsensitiveCollisions() (map[string][]string, error) {
+	query := `
+SELECT lower(short), group_concat(short, ' ')
+  FROM shorty
+ GROUP BY short COLLATE NOCASE
+HAVING count(*) > 1`
+	rows, err := p.db.Query(query)
 	if err != nil {
 		return nil, err
 	}
 	defer rows.Close()
 
-	slice := []*Shortened{}
+	collisions := map[string][]string{}
 	for rows.Next() {
-		s := &Shortened{}
-		if err := rows.Scan(&s.Short, &s.URL, &s.CreatedAt); err != nil {
+		var lower, shorts string
+		if err = rows.Scan(&lower, &shorts); err != nil {
 			return nil, err
 		}
-		slice = append(slice, s)
+		collisions[lower] = strings.Split(shorts, " ")
 	}
-	return slice, nil
+	return collisions, rows.Err()
 }
 
-// addSchema create shorty table, if not present yet.
-func (p *Persistence) addSchema() error {
-	log.Printf("Creating 'shorty' table, if not present.")
-	createTable := `
-CREATE TABLE IF NOT EXISTS shorty (
-	short  		TEXT NOT NULL,
-	url 	    TEXT NOT NULL,
-	created_at 	INTEGER NOT NULL,
-	PRIMARY KEY (short)
-)`
-	if _, err := p.db.Exec(createTable); err != nil {
+// previewSuffixShorts returns the short strings ending with preview suffix, stored before the suffix
+// was reserved, including deleted entries.
+func (p *Persistence) previewSuffixShorts() ([]string, error) {
+	query := "SELECT short FROM shorty WHERE substr(short, -1) = ? ORDER BY short"
+	rows, err := p.db.Query(query, previewSuffix)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	shorts := []string{}
+	for rows.Next() {
+		var short string
+		if err = rows.Scan(&short); err != nil {
+			return nil, err
+		}
+		shorts = append(shorts, short)
+	}
+	return shorts, rows.Err()
+}
+
+// checkPreviewSuffix logs the short strings ending with preview suffix, those are unreachable since
+// requests on them show the preview of the short string without suffix, and must be renamed.
+func (p *Persistence) checkPreviewSuffix() error {
+	shorts, err := p.previewSuffixShorts()
+	if err != nil {
 		return err
 	}
+	for _, short := range shorts {
+		logger.WithField("short", short).
+			Errorf("Short string ends with reserved preview suffix '%s', it's unreachable", previewSuffix)
+	}
 	return nil
 }
 
+// hasCaseInsensitiveIndex checks if the case-insensitive unique index is present.
+func (p *Persistence) hasCaseInsensitiveIndex() (bool, error) {
+	var count int
+	query := "SELECT count(*) FROM sqlite_master WHERE type = 'index' AND name = ?"
+	if err := p.db.QueryRow(query, caseInsensitiveIndexName).Scan(&count); err != nil {
+		return false, err
+	}
+	return count > 0, nil
+}
+
+// caseInsensitiveIndex when case-insensitive mode is enabled, creates a unique index using "NOCASE"
+// collation, making sure existing entries don't collide first. Otherwise, a existing index is kept,
+// since it may belong to a instance running in case-insensitive mode, it must be dropped manually.
+func (p *Persistence) caseInsensitiveIndex() error {
+	if !p.config.CaseInsensitive {
+		found, err := p.hasCaseInsensitiveIndex()
+		if err == nil && found {
+			logger.WithField("index", caseInsensitiveIndexName).
+				Warn("Case-insensitive mode is disabled, but its unique index is kept")
+		}
+		return err
+	}
+
+	collisions, err := p.caseInsensitiveCollisions()
+	if err != nil {
+		return err
+	}
+	if len(collisions) > 0 {
+		for lower, shorts := range collisions {
+			logger.WithField("shorts", shorts).Errorf("Case-insensitive collision on '%s'", lower)
+		}
+		return fmt.Errorf("can't enable case-insensitive mode, '%d' short strings collide",
+			len(collisions))
+	}
+
+	logger.Info("Creating case-insensitive unique index on 'shorty' table, if not present.")
+	createIndex := fmt.Sprintf(`
+CREATE UNIQUE INDEX IF NOT EXISTS %s
+    ON shorty (short COLLATE NOCASE)`, caseInsensitiveIndexName)
+	_, err = p.db.Exec(createIndex)
+	return err
+}
+
 // IsErrNoRows assert if error is about no rows found.
 func (p *Persistence) IsErrNoRows(err error) bool {
 	return sql.ErrNoRows == err
@@ -124,36 +744,50 @@ func (p *Persistence) IsErrUniqueConstraint(err error) bool {
 // Close terminate the connection with database.
 func (p *Persistence) Close() {
 	if err := p.db.Close(); err != nil {
-		log.Printf("Error on closing database connection: '%s'", err)
+		logger.WithError(err).Error("Error on closing database connection")
 	}
 }
 
-// NewPersistence creates a new persistence instance, opens database connection and add schema.
-func NewPersistence(config *Config) (*Persistence, error) {
-	var driverName string
-	var err error
-
-	if driverName, err = ocsql.Register("sqlite3", ocsql.WithAllTraceOptions()); err != nil {
-		log.Fatalf("failed to register ocsql driver: %v\n", err)
-		return nil, err
-	}
-	ocsql.RegisterAllViews()
-
+// openPersistence instantiate persistence and opens database connection, schema is not touched.
+func openPersistence(config *Config) *Persistence {
 	var connStr string
 	if config.DatabaseFile == "" {
-		log.Printf("Starting a in-memory database...")
+		logger.Info("Starting a in-memory database...")
 		connStr = fmt.Sprintf("file::memory:?cache=shared&%s", config.SQLiteFlags)
 	} else {
 		connStr = fmt.Sprintf("%s?%s", config.DatabaseFile, config.SQLiteFlags)
 	}
-	log.Printf("New database connection '%s'", connStr)
+	logger.WithField("connection", connStr).Info("New database connection")
 
-	p := &Persistence{config: config, mu: &sync.Mutex{}}
+	p := &Persistence{
+		config:  config,
+		mu:      &sync.Mutex{},
+		connStr: connStr,
+		metrics: newStorageMetrics(),
+	}
+	p.db = sql.OpenDB(newSQLConnector(&sqlite3.SQLiteDriver{}, connStr))
+	return p
+}
 
-	if p.db, err = sql.Open(driverName, connStr); err != nil {
+// OpenPersistence opens database connection without applying migrations, nor changing indexes, so
+// it's safe to use against the database of a running instance, as command-line tools do.
+func OpenPersistence(config *Config) *Persistence {
+	return openPersistence(config)
+}
+
+// NewPersistence creates a new persistence instance, opens database connection and add schema.
+func NewPersistence(config *Config) (*Persistence, error) {
+	p := openPersistence(config)
+	if err := p.migrate(); err != nil {
+		p.Close()
+		return nil, err
+	}
+	if err := p.caseInsensitiveIndex(); err != nil {
+		p.Close()
 		return nil, err
 	}
-	if err = p.addSchema(); err != nil {
+	if err := p.checkPreviewSuffix(); err != nil {
+		p.Close()
 		return nil, err
 	}
 
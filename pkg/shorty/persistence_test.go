@@ -3,7 +3,9 @@ package shorty
 import (
 	"context"
 	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -28,7 +30,7 @@ func TestPersistenceNew(t *testing.T) {
 
 	DeleteDatabaseFile(t)
 
-	config := &Config{DatabaseFile: databaseFile}
+	config := &Config{StorageConfig: StorageConfig{DatabaseFile: databaseFile}}
 	persistence, err = NewPersistence(config)
 
 	assert.Nil(t, err)
@@ -53,3 +55,194 @@ func TestPersistenceRead(t *testing.T) {
 	assert.Equal(t, longURL, shortened.URL)
 	assert.Equal(t, createdAt, shortened.CreatedAt)
 }
+
+func TestPersistenceSoftDelete(t *testing.T) {
+	ctx := context.Background()
+
+	err := persistence.Delete(ctx, short)
+	assert.Nil(t, err)
+	err = persistence.Delete(ctx, short)
+	assert.True(t, persistence.IsErrNoRows(err))
+
+	shortened, err := persistence.Read(ctx, short)
+	assert.Nil(t, err)
+	assert.True(t, shortened.DeletedAt > 0)
+
+	slice, err := persistence.List(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, slice, 0)
+
+	slice, err = persistence.Trash(ctx)
+	assert.Nil(t, err)
+	assert.Len(t, slice, 1)
+
+	t.Log("Purging entries deleted before deletion timestamp must not remove entry")
+	purged, err := persistence.Purge(ctx, shortened.DeletedAt)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), purged)
+
+	err = persistence.Undelete(ctx, short)
+	assert.Nil(t, err)
+	err = persistence.Undelete(ctx, short)
+	assert.True(t, persistence.IsErrNoRows(err))
+
+	shortened, err = persistence.Read(ctx, short)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), shortened.DeletedAt)
+
+	t.Log("Purging must remove entries deleted before informed timestamp")
+	assert.Nil(t, persistence.Delete(ctx, short))
+	purged, err = persistence.Purge(ctx, time.Now().Unix()+1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), purged)
+
+	_, err = persistence.Read(ctx, short)
+	assert.True(t, persistence.IsErrNoRows(err))
+}
+
+func TestPersistenceCaseInsensitive(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-nocase.sqlite",
+	}}
+	_ = os.Remove(config.DatabaseFile)
+
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: "abc", URL: longURL}))
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: "ABC", URL: longURL}))
+	p.Close()
+
+	t.Log("Colliding short strings must prevent enabling case-insensitive mode")
+	config.CaseInsensitive = true
+	_, err = NewPersistence(config)
+	assert.Error(t, err)
+
+	_ = os.Remove(config.DatabaseFile)
+	p, err = NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: "abc", URL: longURL}))
+	err = p.Write(ctx, &Shortened{Short: "ABC", URL: longURL})
+	assert.Error(t, err)
+	assert.True(t, p.IsErrUniqueConstraint(err))
+
+	shortened, err := p.Read(ctx, "ABC")
+	assert.Nil(t, err)
+	assert.Equal(t, "abc", shortened.Short)
+
+	t.Log("Opening without case-insensitive mode must keep the unique index")
+	config.CaseInsensitive = false
+	other := OpenPersistence(config)
+	err = other.Write(ctx, &Shortened{Short: "ABC", URL: longURL})
+	assert.Error(t, err)
+	assert.True(t, other.IsErrUniqueConstraint(err))
+	other.Close()
+
+	other, err = NewPersistence(config)
+	assert.Nil(t, err)
+	defer other.Close()
+	found, err := other.hasCaseInsensitiveIndex()
+	assert.Nil(t, err)
+	assert.True(t, found)
+}
+
+func TestPersistencePreviewSuffixShorts(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-preview-suffix.sqlite",
+	}}
+	_ = os.Remove(config.DatabaseFile)
+
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: "abc+", URL: longURL}))
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: "a+b", URL: longURL}))
+	p.Close()
+
+	t.Log("Short strings ending with preview suffix must be listed, without preventing start-up")
+	p, err = NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	shorts, err := p.previewSuffixShorts()
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"abc+"}, shorts)
+}
+
+func TestPersistenceOpenWithoutMigrations(t *testing.T) {
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-open.sqlite",
+	}}
+	_ = os.Remove(config.DatabaseFile)
+
+	p := OpenPersistence(config)
+	defer p.Close()
+
+	version, err := p.schemaVersion()
+	assert.Nil(t, err)
+	assert.Equal(t, 0, version)
+	assert.Error(t, p.Migrated(context.Background()))
+}
+
+func TestPersistenceImportEach(t *testing.T) {
+	ctx := context.Background()
+	config := &Config{StorageConfig: StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-test-import.sqlite",
+	}}
+	_ = os.Remove(config.DatabaseFile)
+
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+
+	importCSV := func(payload, onConflict string) (*ImportStats, error) {
+		dec, err := NewDecoder(strings.NewReader(payload), FormatCSV)
+		assert.Nil(t, err)
+		return p.Import(ctx, dec, onConflict)
+	}
+
+	stats, err := importCSV("short,url,created_at\na,http://a.com,1\nb,http://b.com,2\n_c,x,3\n",
+		OnConflictSkip)
+	assert.Nil(t, err)
+	assert.Equal(t, &ImportStats{Imported: 2, Invalid: 1}, stats)
+
+	stats, err = importCSV("a,http://other.com,1\nd,http://d.com,4\n", OnConflictSkip)
+	assert.Nil(t, err)
+	assert.Equal(t, &ImportStats{Imported: 1, Skipped: 1}, stats)
+
+	t.Log("Failing import must not store any entry")
+	_, err = importCSV("e,http://e.com,5\na,http://other.com,1\n", OnConflictFail)
+	assert.Error(t, err)
+	_, err = p.Read(ctx, "e")
+	assert.True(t, p.IsErrNoRows(err))
+
+	stats, err = importCSV("a,http://other.com,1\n", OnConflictOverwrite)
+	assert.Nil(t, err)
+	assert.Equal(t, &ImportStats{Imported: 1}, stats)
+
+	_, err = importCSV("", "bogus")
+	assert.Error(t, err)
+
+	t.Log("Entries carrying a password hash which is not bcrypt must be invalid")
+	hash := "$2a$10$N9qo8uLOickgx2ZMRZoMyeIjZAgcfl7p92ldGxad68LJZdL17lhWy"
+	stats, err = importCSV("f,http://f.com,6,false,garbage\ng,http://g.com,7,false,"+hash+"\n",
+		OnConflictSkip)
+	assert.Nil(t, err)
+	assert.Equal(t, &ImportStats{Imported: 1, Invalid: 1}, stats)
+	_, err = p.Read(ctx, "f")
+	assert.True(t, p.IsErrNoRows(err))
+
+	shorts := []string{}
+	err = p.Each(ctx, func(s *Shortened) error {
+		shorts = append(shorts, s.Short)
+		return nil
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "d", "g"}, shorts)
+
+	shortened, err := p.Read(ctx, "a")
+	assert.Nil(t, err)
+	assert.Equal(t, "http://other.com", shortened.URL)
+}
@@ -0,0 +1,119 @@
+package shorty
+
+import (
+	"fmt"
+	"html/template"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// previewSuffix short strings informed with this suffix always show the preview page.
+	previewSuffix = "+"
+	// continueKey gin context key, set when continuing from the preview page to the redirect.
+	continueKey = "continue"
+)
+
+// pageLayout layout of pages shown on short links, pages define their "content" template.
+var pageLayout = template.Must(template.New("layout").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <meta name="viewport" content="width=device-width, initial-scale=1">
+  <meta name="robots" content="noindex">
+  <title>shorty: {{.Short}}</title>
+  <style>
+    body { margin: 3rem auto; max-width: 40rem; padding: 1rem; color: #24292e;
+      font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", Helvetica, Arial, sans-serif; }
+    .host { font-size: 1.5rem; font-weight: 600; }
+    .url { color: #586069; word-break: break-all; }
+    .error { color: #cb2431; }
+    input { padding: 0.5rem; border: 1px solid #d1d5da; border-radius: 4px; font-size: 1rem; }
+    .continue { display: inline-block; margin-top: 1rem; padding: 0.5rem 1rem; color: #fff;
+      background: #2ea44f; border: 0; border-radius: 4px; font-size: 1rem; text-decoration: none;
+      cursor: pointer; }
+  </style>
+</head>
+<body>
+{{- template "content" .}}
+</body>
+</html>
+`))
+
+// previewTemplate interstitial page showing where a short link leads, before following it. Links
+// limited by maximum clicks only show the host, and continue through a form accounting the click,
+// carrying the password of protected links.
+var previewTemplate = template.Must(template.Must(pageLayout.Clone()).Parse(`
+{{define "content"}}
+  <p>The short link <strong>{{.Short}}</strong> leads to:</p>
+  <p class="host">{{.Host}}</p>
+  {{- if .Action}}
+  <form method="post" action="{{.Action}}">
+    {{with .Password}}<input name="password" type="hidden" value="{{.}}">{{end}}
+    <button class="continue" type="submit">Continue</button>
+  </form>
+  {{- else}}
+  <p class="url">{{.URL}}</p>
+  <a class="continue" href="{{.URL}}" rel="noreferrer noopener">Continue</a>
+  {{- end}}
+{{end}}`))
+
+// trimPreviewSuffix removes the preview suffix from short string, informing whether it's present.
+func trimPreviewSuffix(short string) (string, bool) {
+	if strings.HasSuffix(short, previewSuffix) {
+		return strings.TrimSuffix(short, previewSuffix), true
+	}
+	return short, false
+}
+
+// renderPage responds with the page rendered with data, failures are only logged since the status
+// has been written already.
+func renderPage(c *gin.Context, status int, page *template.Template, data gin.H) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Status(status)
+	if err := page.Execute(c.Writer, data); err != nil {
+		logEntry(c.Request.Context()).WithError(err).Error("Rendering page")
+	}
+}
+
+// preview responds with the preview page of the entry, or the entry itself when JSON is accepted.
+// The URL of entries limited by maximum clicks is not shown, it's only handed out by continuing,
+// so every visit accounts a click.
+func (h *Handler) preview(c *gin.Context, shortened *Shortened) {
+	c.Header("Cache-Control", "no-store")
+	c.Header("Referrer-Policy", "no-referrer")
+	limited := shortened.MaxClicks > 0
+	if c.NegotiateFormat(gin.MIMEHTML, gin.MIMEJSON) == gin.MIMEJSON {
+		if limited {
+			concealed := *shortened
+			concealed.URL = ""
+			shortened = &concealed
+		}
+		c.JSONP(http.StatusOK, shortened)
+		return
+	}
+
+	host := shortened.URL
+	if parsed, err := url.Parse(shortened.URL); err == nil && parsed.Host != "" {
+		host = parsed.Hostname()
+	}
+	data := gin.H{"Short": shortened.Short, "Host": host, "URL": shortened.URL}
+	if limited {
+		data["URL"] = ""
+		data["Action"] = fmt.Sprintf("/shorty/%s/continue", url.PathEscape(shortened.Short))
+		if shortened.Protected {
+			data["Password"] = informedPassword(c)
+		}
+	}
+	renderPage(c, http.StatusOK, previewTemplate, data)
+}
+
+// Continue follows the short link from the preview page, redirecting instead of showing the
+// preview again, so links limited by maximum clicks account the click here.
+func (h *Handler) Continue(c *gin.Context) {
+	c.Set(continueKey, true)
+	h.Read(c)
+}
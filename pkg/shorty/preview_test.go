@@ -0,0 +1,145 @@
+package shorty
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPreview(t *testing.T) {
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-preview.sqlite"
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	ctx := context.Background()
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: short, URL: longURL}))
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: "flagged", URL: "https://a.com/<b>", Preview: true}))
+
+	h := NewHandler(p)
+	router := gin.New()
+	router.GET("/shorty/:short", h.Read)
+	router.PUT("/shorty/:short", h.Update)
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		return recorderServeHTTP(router, req)
+	}
+
+	t.Log("Entries are redirected, unless informed with preview suffix")
+	assert.Equal(t, http.StatusTemporaryRedirect, get("/shorty/abc", "").Code)
+	rr := get("/shorty/abc+", "text/html")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "no-store", rr.Header().Get("Cache-Control"))
+	assert.Empty(t, rr.Header().Get("Location"))
+	assert.Contains(t, rr.Body.String(), `<p class="host">x.y.z</p>`)
+	assert.Contains(t, rr.Body.String(), `href="http://x.y.z"`)
+
+	t.Log("Flagged entries always show preview, escaping the URL")
+	rr = get("/shorty/flagged", "text/html")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, rr.Body.String(), `<p class="host">a.com</p>`)
+	assert.Contains(t, rr.Body.String(), `https://a.com/&lt;b&gt;`)
+
+	t.Log("JSON clients receive the entry instead of the page")
+	rr = get("/shorty/flagged+", "application/json")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var shortened Shortened
+	assert.Nil(t, json.Unmarshal(rr.Body.Bytes(), &shortened))
+	assert.True(t, shortened.Preview)
+	assert.Equal(t, "https://a.com/<b>", shortened.URL)
+
+	t.Log("Update keeps preview flag when not informed")
+	put := func(short, body string) int {
+		req := httptest.NewRequest("PUT", "/shorty/"+short, strings.NewReader(body))
+		return recorderServeHTTP(router, req).Code
+	}
+	assert.Equal(t, http.StatusOK, put("flagged", `{"url":"https://b.com"}`))
+	assert.Equal(t, http.StatusOK, get("/shorty/flagged", "text/html").Code)
+	assert.Equal(t, http.StatusOK, put("flagged", `{"url":"https://b.com","preview":false}`))
+	assert.Equal(t, http.StatusTemporaryRedirect, get("/shorty/flagged", "text/html").Code)
+
+	assert.Equal(t, http.StatusNoContent, get("/shorty/missing+", "text/html").Code)
+}
+
+func TestPreviewMaxClicks(t *testing.T) {
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-preview-clicks.sqlite"
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	ctx := context.Background()
+	secretURL := "https://a.com/download?token=s3cret"
+	once := &Shortened{Short: "once", URL: secretURL, Preview: true, MaxClicks: 1}
+	assert.Nil(t, p.Write(ctx, once))
+	protected := &Shortened{
+		Short: "guarded", URL: secretURL, Preview: true, MaxClicks: 1, Password: "pw"}
+	assert.Nil(t, protected.hashPassword())
+	assert.Nil(t, p.Write(ctx, protected))
+
+	h := NewHandler(p)
+	router := gin.New()
+	router.GET("/shorty/:short", h.Read)
+	router.POST("/shorty/:short/unlock", h.Read)
+	router.POST("/shorty/:short/continue", h.Continue)
+	get := func(path, accept string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("GET", path, nil)
+		req.Header.Set("Accept", accept)
+		return recorderServeHTTP(router, req)
+	}
+	post := func(path, form string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest("POST", path, strings.NewReader(form))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return recorderServeHTTP(router, req)
+	}
+	clicks := func(short string) int64 {
+		stored, err := p.Read(ctx, short)
+		assert.Nil(t, err)
+		return stored.Clicks
+	}
+
+	t.Log("Preview of limited entries must not hand out the URL, nor account a click")
+	for i := 0; i < 3; i++ {
+		for _, rr := range []*httptest.ResponseRecorder{
+			get("/shorty/once", "text/html"),
+			get("/shorty/once+", "text/html"),
+			get("/shorty/once", "application/json"),
+		} {
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.NotContains(t, rr.Body.String(), "s3cret")
+		}
+	}
+	rr := get("/shorty/once", "text/html")
+	assert.Contains(t, rr.Body.String(), `<p class="host">a.com</p>`)
+	assert.Contains(t, rr.Body.String(), `action="/shorty/once/continue"`)
+	assert.Equal(t, int64(0), clicks("once"))
+
+	t.Log("Continuing must account the click and redirect, only once")
+	rr = post("/shorty/once/continue", "")
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+	assert.Equal(t, secretURL, rr.Header().Get("Location"))
+	assert.Equal(t, int64(1), clicks("once"))
+	assert.Equal(t, http.StatusGone, post("/shorty/once/continue", "").Code)
+	assert.Equal(t, http.StatusGone, get("/shorty/once", "text/html").Code)
+
+	t.Log("Protected entries must carry the password on continue")
+	rr = post("/shorty/guarded/unlock", "password=pw")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotContains(t, rr.Body.String(), "s3cret")
+	assert.Contains(t, rr.Body.String(), `name="password" type="hidden" value="pw"`)
+	assert.Equal(t, http.StatusUnauthorized, post("/shorty/guarded/continue", "").Code)
+	assert.Equal(t, int64(0), clicks("guarded"))
+	rr = post("/shorty/guarded/continue", "password=pw")
+	assert.Equal(t, http.StatusSeeOther, rr.Code)
+	assert.Equal(t, secretURL, rr.Header().Get("Location"))
+	assert.Equal(t, int64(1), clicks("guarded"))
+}
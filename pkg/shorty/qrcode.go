@@ -0,0 +1,247 @@
+package shorty
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+)
+
+// QR code image formats.
+const (
+	qrFormatPNG = "png"
+	qrFormatSVG = "svg"
+)
+
+// QR code size, in pixels, and margin, in modules, limits and defaults.
+const (
+	qrMinSize       = 64
+	qrMaxSize       = 2048
+	qrDefaultSize   = 256
+	qrMaxMargin     = 16
+	qrDefaultMargin = 4
+)
+
+// qrLevels error correction levels, recovering about 7%, 15%, 25% and 30% of the code.
+var qrLevels = map[string]qrcode.RecoveryLevel{
+	"L": qrcode.Low,
+	"M": qrcode.Medium,
+	"Q": qrcode.High,
+	"H": qrcode.Highest,
+}
+
+// qrOptions QR code rendering options, informed as query parameters.
+type qrOptions struct {
+	format string     // image format, png or svg
+	size   int        // image width and height in pixels
+	level  string     // error correction level, L, M, Q or H
+	margin int        // quiet zone around the code, in modules
+	fg     color.RGBA // foreground, dark modules, color
+	bg     color.RGBA // background color
+}
+
+// etag strong entity tag of the QR code for the content, rendered with these options.
+func (o *qrOptions) etag(content string) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s|%s|%d|%s|%d|%s|%s",
+		content, o.format, o.size, o.level, o.margin, hexColor(o.fg), hexColor(o.bg))))
+	return fmt.Sprintf(`"%s"`, hex.EncodeToString(sum[:16]))
+}
+
+// render renders the QR code bitmap, without border, as image in the configured format, returning
+// the image and its content-type.
+func (o *qrOptions) render(bitmap [][]bool) ([]byte, string, error) {
+	if o.format == qrFormatSVG {
+		return o.svg(bitmap), "image/svg+xml", nil
+	}
+	data, err := o.png(bitmap)
+	return data, "image/png", err
+}
+
+// png renders the bitmap as PNG image, modules are scaled by a integer factor and the code is
+// centered in the image.
+func (o *qrOptions) png(bitmap [][]bool) ([]byte, error) {
+	modules := len(bitmap) + 2*o.margin
+	scale := o.size / modules
+	if scale < 1 {
+		return nil, fmt.Errorf("size %d is too small for a code of %d modules", o.size, modules)
+	}
+	offset := (o.size-scale*modules)/2 + o.margin*scale
+
+	// palette index zero is the background, image starts filled with it
+	img := image.NewPaletted(image.Rect(0, 0, o.size, o.size), color.Palette{o.bg, o.fg})
+	for y, row := range bitmap {
+		for x, dark := range row {
+			if !dark {
+				continue
+			}
+			for py := 0; py < scale; py++ {
+				for px := 0; px < scale; px++ {
+					img.SetColorIndex(offset+x*scale+px, offset+y*scale+py, 1)
+				}
+			}
+		}
+	}
+
+	var buf bytes.Buffer
+	enc := png.Encoder{CompressionLevel: png.BestCompression}
+	if err := enc.Encode(&buf, img); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// svg renders the bitmap as SVG image, each run of dark modules in a row is a path segment.
+func (o *qrOptions) svg(bitmap [][]bool) []byte {
+	modules := len(bitmap) + 2*o.margin
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, `<svg xmlns="http://www.w3.org/2000/svg" width="%d" height="%d" `+
+		`viewBox="0 0 %d %d" shape-rendering="crispEdges">`, o.size, o.size, modules, modules)
+	fmt.Fprintf(&buf, `<rect width="100%%" height="100%%" fill="%s"/>`, hexColor(o.bg))
+	fmt.Fprintf(&buf, `<path fill="%s" d="`, hexColor(o.fg))
+	for y, row := range bitmap {
+		for x := 0; x < len(row); x++ {
+			if !row[x] {
+				continue
+			}
+			start := x
+			for x < len(row) && row[x] {
+				x++
+			}
+			fmt.Fprintf(&buf, "M%d %dh%dv1h-%dz", start+o.margin, y+o.margin, x-start, x-start)
+		}
+	}
+	buf.WriteString(`"/></svg>`)
+	return buf.Bytes()
+}
+
+// parseQROptions parses rendering options from query parameters, using defaults when not informed.
+func parseQROptions(c *gin.Context) (*qrOptions, error) {
+	o := &qrOptions{
+		format: strings.ToLower(c.DefaultQuery("format", qrFormatPNG)),
+		level:  strings.ToUpper(c.DefaultQuery("level", "M")),
+	}
+	var err error
+
+	if o.format != qrFormatPNG && o.format != qrFormatSVG {
+		return nil, fmt.Errorf("invalid format '%s', png or svg are supported", o.format)
+	}
+	if _, found := qrLevels[o.level]; !found {
+		return nil, fmt.Errorf("invalid level '%s', L, M, Q or H are supported", o.level)
+	}
+	if o.size, err = intQuery(c, "size", qrDefaultSize, qrMinSize, qrMaxSize); err != nil {
+		return nil, err
+	}
+	if o.margin, err = intQuery(c, "margin", qrDefaultMargin, 0, qrMaxMargin); err != nil {
+		return nil, err
+	}
+	if o.fg, err = parseColor(c.DefaultQuery("fg", "000000")); err != nil {
+		return nil, err
+	}
+	if o.bg, err = parseColor(c.DefaultQuery("bg", "ffffff")); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+// intQuery parses the query parameter as integer between min and max, default when not informed.
+func intQuery(c *gin.Context, name string, value, min, max int) (int, error) {
+	if param, found := c.GetQuery(name); found {
+		var err error
+		if value, err = strconv.Atoi(param); err != nil || value < min || value > max {
+			return 0, fmt.Errorf("%s must be a number between %d and %d", name, min, max)
+		}
+	}
+	return value, nil
+}
+
+// parseColor parses a opaque color informed as hexadecimal RGB, as in "ff0000" or "#ff0000".
+func parseColor(value string) (color.RGBA, error) {
+	rgb, err := hex.DecodeString(strings.TrimPrefix(value, "#"))
+	if err != nil || len(rgb) != 3 {
+		return color.RGBA{}, fmt.Errorf("invalid color '%s', expected as 'rrggbb'", value)
+	}
+	return color.RGBA{R: rgb[0], G: rgb[1], B: rgb[2], A: 0xff}, nil
+}
+
+// hexColor formats the color as hexadecimal RGB, as in "#ff0000".
+func hexColor(c color.RGBA) string {
+	return fmt.Sprintf("#%02x%02x%02x", c.R, c.G, c.B)
+}
+
+// matchETag checks if the entity tag is listed on "If-None-Match" header, weak comparison.
+func matchETag(header, etag string) bool {
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// shortURL public URL of the short string. When public URL is not configured, it's based on the
+// request scheme and host.
+func shortURL(publicURL string, r *http.Request, short string) string {
+	if publicURL == "" {
+		scheme := "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+		publicURL = fmt.Sprintf("%s://%s", scheme, r.Host)
+	}
+	return fmt.Sprintf("%s/shorty/%s", strings.TrimSuffix(publicURL, "/"), url.PathEscape(short))
+}
+
+// QRCode serves the QR code of the public short URL, rendered as informed by query parameters. The
+// short URL does not change, so images are validated by entity tag.
+func (h *Handler) QRCode(publicURL string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		options, err := parseQROptions(c)
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, h.mapErr(err))
+			return
+		}
+		shortened, err := h.persistence.Read(c.Request.Context(), c.Param("short"))
+		if err != nil {
+			h.abortOnMutationErr(c, err)
+			return
+		}
+		if shortened.DeletedAt > 0 {
+			c.AbortWithStatusJSON(http.StatusGone, gin.H{"msg": "short link has been deleted"})
+			return
+		}
+
+		content := shortURL(publicURL, c.Request, shortened.Short)
+		etag := options.etag(content)
+		c.Header("ETag", etag)
+		c.Header("Cache-Control", "no-cache")
+		if matchETag(c.GetHeader("If-None-Match"), etag) {
+			c.Status(http.StatusNotModified)
+			return
+		}
+
+		qr, err := qrcode.New(content, qrLevels[options.level])
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, h.mapErr(err))
+			return
+		}
+		qr.DisableBorder = true
+		data, contentType, err := options.render(qr.Bitmap())
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, h.mapErr(err))
+			return
+		}
+		c.Data(http.StatusOK, contentType, data)
+	}
+}
@@ -0,0 +1,101 @@
+package shorty
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/skip2/go-qrcode"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQRCode(t *testing.T) {
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-qrcode.sqlite"
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	ctx := context.Background()
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: short, URL: longURL}))
+	assert.Nil(t, p.Write(ctx, &Shortened{Short: "deleted", URL: longURL}))
+	assert.Nil(t, p.Delete(ctx, "deleted"))
+
+	router := gin.New()
+	router.GET("/shorty/:short/qr", NewHandler(p).QRCode("https://sho.rt"))
+	get := func(path string) *httptest.ResponseRecorder {
+		return recorderServeHTTP(router, httptest.NewRequest("GET", path, nil))
+	}
+
+	t.Log("PNG must be rendered with informed size and colors, and margin on background")
+	rr := get("/shorty/abc/qr?size=300&fg=ff0000&bg=%2300ff00")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+	img, err := png.Decode(bytes.NewReader(rr.Body.Bytes()))
+	assert.Nil(t, err)
+	assert.Equal(t, 300, img.Bounds().Dx())
+	assert.Equal(t, 300, img.Bounds().Dy())
+	r, g, b, _ := img.At(0, 0).RGBA()
+	assert.Equal(t, []uint32{0, 0xffff, 0}, []uint32{r, g, b})
+	// finder pattern starts on the top-left corner, after the margin
+	qr, err := qrcode.New("https://sho.rt/shorty/abc", qrcode.Medium)
+	assert.Nil(t, err)
+	qr.DisableBorder = true
+	modules := len(qr.Bitmap()) + 2*qrDefaultMargin
+	offset := (300-300/modules*modules)/2 + qrDefaultMargin*(300/modules)
+	r, g, b, _ = img.At(offset, offset).RGBA()
+	assert.Equal(t, []uint32{0xffff, 0, 0}, []uint32{r, g, b})
+	r, g, b, _ = img.At(offset-1, offset-1).RGBA()
+	assert.Equal(t, []uint32{0, 0xffff, 0}, []uint32{r, g, b})
+
+	t.Log("Entity tag must validate cached images, and change with options")
+	etag := rr.Header().Get("ETag")
+	assert.NotEmpty(t, etag)
+	req := httptest.NewRequest("GET", "/shorty/abc/qr?size=300&fg=ff0000&bg=%2300ff00", nil)
+	req.Header.Set("If-None-Match", `"other", W/`+etag)
+	rr = recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.Bytes())
+	assert.NotEqual(t, etag, get("/shorty/abc/qr?size=300").Header().Get("ETag"))
+
+	t.Log("SVG must be rendered with informed colors")
+	rr = get("/shorty/abc/qr?format=svg&level=h&margin=0&fg=112233")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/svg+xml", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Body.String(), `<path fill="#112233" d="M0 0h7v1h-7z`)
+	assert.Contains(t, rr.Body.String(), `<rect width="100%" height="100%" fill="#ffffff"/>`)
+
+	for _, query := range []string{
+		"format=gif", "level=X", "size=10", "size=big", "margin=17", "fg=red", "bg=%23fff",
+	} {
+		assert.Equal(t, http.StatusBadRequest, get("/shorty/abc/qr?"+query).Code, query)
+	}
+	assert.Equal(t, http.StatusNotFound, get("/shorty/missing/qr").Code)
+	assert.Equal(t, http.StatusGone, get("/shorty/deleted/qr").Code)
+}
+
+func TestQRCodeShortURL(t *testing.T) {
+	req := httptest.NewRequest("GET", "http://admin:8443/shorty/abc/qr", nil)
+	assert.Equal(t, "https://sho.rt/shorty/a%20b", shortURL("https://sho.rt/", req, "a b"))
+	assert.Equal(t, "http://admin:8443/shorty/abc", shortURL("", req, short))
+
+	req.TLS = &tls.ConnectionState{}
+	assert.Equal(t, "https://admin:8443/shorty/abc", shortURL("", req, short))
+}
+
+func TestQRCodeParseColor(t *testing.T) {
+	c, err := parseColor("#0a0B0c")
+	assert.Nil(t, err)
+	assert.Equal(t, color.RGBA{R: 0x0a, G: 0x0b, B: 0x0c, A: 0xff}, c)
+	assert.Equal(t, "#0a0b0c", hexColor(c))
+
+	_, err = parseColor("0a0b0c0d")
+	assert.NotNil(t, err)
+}
@@ -3,6 +3,15 @@ package shorty
 // Shortened represents a entry in persistence store.
 type Shortened struct {
 	Short     string `json:"short,omitempty"`      // short URL
-	URL       string `json:"url"`                  // original URL
+	URL       string `json:"url,omitempty"`        // original URL, not shown when concealed
 	CreatedAt int64  `json:"created_at,omitempty"` // created timestamp
+	DeletedAt int64  `json:"deleted_at,omitempty"` // deleted timestamp, zero when not deleted
+	Preview   bool   `json:"preview,omitempty"`    // show preview page instead of redirecting
+	Protected bool   `json:"protected,omitempty"`  // password is required to follow
+	MaxClicks int64  `json:"max_clicks,omitempty"` // clicks allowed, zero is unlimited
+	Clicks    int64  `json:"clicks,omitempty"`     // clicks accounted, when limited
+	// Password informed on create, replaced by its hash before stored
+	Password string `json:"password,omitempty"`
+	// PasswordHash bcrypt hash of password, empty when not protected, never shown on responses
+	PasswordHash string `json:"-"`
 }
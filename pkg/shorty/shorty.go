@@ -1,98 +1,478 @@
 package shorty
 
 import (
-	"log"
+	"context"
+	"crypto/x509"
 	"net/http"
+	"net/http/pprof"
 	"os"
+	"os/signal"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/prometheus/client_golang/prometheus"
-	ocpromexp "go.opencensus.io/exporter/prometheus"
-	"go.opencensus.io/plugin/ochttp"
-	"go.opencensus.io/stats/view"
-	"go.opencensus.io/trace"
+	"github.com/sirupsen/logrus"
 )
 
+// purgeInterval interval between purges of deleted entries.
+const purgeInterval = 10 * time.Minute
+
+// ConfigLoader loads the configuration again, used to reload settings on SIGHUP.
+type ConfigLoader func() (*Config, error)
+
 // Shorty main application component.
 type Shorty struct {
-	config      *Config
-	engine      *gin.Engine
-	exporter    *ocpromexp.Exporter
-	handler     *Handler
-	persistence *Persistence
-	stopChan    chan os.Signal
+	config       *Config
+	live         atomic.Value // *Config, current settings replaced on reload
+	loader       ConfigLoader // loads configuration on reload, optional
+	reloadChan   chan os.Signal
+	engine       *gin.Engine
+	telemetry    *telemetry
+	handler      *Handler
+	persistence  *Persistence
+	stopChan     chan os.Signal
+	certReloader *certReloader        // serves TLS certificates, nil when TLS is not enabled
+	adminEngine  *gin.Engine          // admin listener routes, nil when not enabled
+	clientCAs    *x509.CertPool       // CAs to verify admin listener client certificates
+	accessLog    *accessLogger        // access logger, nil when disabled
+	inherited    []*inheritedListener // listeners passed by systemd, not taken yet
+	done         chan struct{}        // closed on shutdown, stops background workers
+	workers      *sync.WaitGroup      // background workers
+
+	workersStarted int32 // amount of background workers started, atomic
+	workersRunning int32 // amount of background workers running, atomic
+	shuttingDown   int32 // set to one when shutting down, atomic
 }
 
-// httpServer uses configuration to spin up a new http server, and start serving content until os
-// signal is sent.
-func (s Shorty) httpServer() {
-	server := &http.Server{
-		Addr:         s.config.Address,
+// newServer http server for the address and handler, using configured timeouts.
+func (s *Shorty) newServer(address string, handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:         address,
 		ReadTimeout:  time.Duration(s.config.ReadTimeout) * time.Second,
 		WriteTimeout: time.Duration(s.config.WriteTimeout) * time.Second,
 		IdleTimeout:  time.Duration(s.config.IdleTimeout) * time.Second,
-		Handler: &ochttp.Handler{
-			Handler: s.engine,
-			GetStartOptions: func(r *http.Request) trace.StartOptions {
-				startOptions := trace.StartOptions{}
-				if r.URL.Path == "/metrics" {
-					startOptions.Sampler = trace.NeverSample()
-				}
-				return startOptions
-			},
-		},
+		Handler:      handler,
+	}
+}
+
+// serve starts serving on a new listener for server address, using TLS when server carries TLS
+// configuration. Errors are sent to the channel, except for server closed.
+func (s *Shorty) serve(server *http.Server, errChan chan<- error) error {
+	listener, err := s.listen(server.Addr)
+	if err != nil {
+		return err
 	}
 
 	go func() {
-		log.Printf("Listening on '%s'", s.config.Address)
-		if err := server.ListenAndServe(); err != nil {
-			log.Printf("Error: '%s'", err)
-			s.stopChan <- os.Kill
+		var err error
+		if server.TLSConfig != nil {
+			logger.WithField("address", server.Addr).Info("Listening (HTTPS)")
+			err = server.ServeTLS(listener, "", "")
+		} else {
+			logger.WithField("address", server.Addr).Info("Listening")
+			err = server.Serve(listener)
+		}
+		if err != nil && err != http.ErrServerClosed {
+			errChan <- err
 		}
 	}()
+	return nil
+}
+
+// httpServer uses configuration to spin up a new http server, and start serving content until os
+// signal is sent. On signal, the server stops accepting new connections and waits for in-flight
+// requests, up to the configured shutdown timeout. When TLS is enabled, the server uses HTTPS, and
+// optionally a plain HTTP server redirects to HTTPS. The admin server is started when configured,
+// using HTTPS when TLS is enabled, and requiring client certificates when CAs are informed.
+func (s *Shorty) httpServer() error {
+	server := s.newServer(s.config.Address, instrumented(s.engine))
+	servers := []*http.Server{server}
 
-	// block until os signal is sent
-	<-s.stopChan
+	if s.certReloader != nil {
+		server.TLSConfig = newTLSConfig(s.certReloader)
+		if s.config.TLSRedirectAddress != "" {
+			redirect := redirectToHTTPS(s.config.Address)
+			servers = append(servers, s.newServer(s.config.TLSRedirectAddress, redirect))
+		}
+	}
+	if s.adminEngine != nil {
+		admin := s.newServer(s.config.AdminAddress, instrumented(s.adminEngine))
+		if s.clientCAs != nil {
+			admin.TLSConfig = newMutualTLSConfig(s.certReloader, s.clientCAs)
+		} else if s.certReloader != nil {
+			admin.TLSConfig = newTLSConfig(s.certReloader)
+		}
+		servers = append(servers, admin)
+	}
+
+	errChan := make(chan error, len(servers))
+	for _, srv := range servers {
+		if err := s.serve(srv, errChan); err != nil {
+			logger.WithError(err).Error("Error on listening")
+			s.shutdownServers(servers)
+			return err
+		}
+	}
+
+	// block until os signal is sent, or server fails
+	var err error
+	select {
+	case sig := <-s.stopChan:
+		logger.WithField("signal", sig.String()).Info("Received signal, shutting down...")
+	case err = <-errChan:
+		logger.WithError(err).Error("Server error, shutting down...")
+	}
+	atomic.StoreInt32(&s.shuttingDown, 1)
+
+	if delaySeconds := s.settings().ShutdownDelay; err == nil && delaySeconds > 0 {
+		delay := time.Duration(delaySeconds) * time.Second
+		logger.WithField("delay", delay.String()).Info("Failing readiness before shutting down...")
+		time.Sleep(delay)
+	}
+
+	if shutdownErr := s.shutdownServers(servers); err == nil {
+		err = shutdownErr
+	}
+	return err
+}
+
+// shutdownServers gracefully shuts down servers, waiting for in-flight requests up to the
+// configured shutdown timeout.
+func (s *Shorty) shutdownServers(servers []*http.Server) error {
+	timeout := time.Duration(s.settings().ShutdownTimeout) * time.Second
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	logger.WithField("timeout", timeout.String()).Info("Waiting for in-flight requests...")
+	var err error
+	for _, server := range servers {
+		if shutdownErr := server.Shutdown(ctx); shutdownErr != nil {
+			logger.WithError(shutdownErr).WithField("address", server.Addr).
+				Error("Error on shutting down http server")
+			err = shutdownErr
+		}
+	}
+	logger.Info("HTTP server is stopped.")
+	return err
+}
+
+// startWorker runs the function in background, it must return when done channel is closed.
+func (s *Shorty) startWorker(fn func()) {
+	s.workers.Add(1)
+	atomic.AddInt32(&s.workersStarted, 1)
+	atomic.AddInt32(&s.workersRunning, 1)
+	go func() {
+		defer s.workers.Done()
+		defer atomic.AddInt32(&s.workersRunning, -1)
+		fn()
+	}()
+}
+
+// stopWorkers signals background workers to stop, and wait for them to finish.
+func (s *Shorty) stopWorkers() {
+	close(s.done)
+	s.workers.Wait()
+	logger.Info("Background workers are stopped.")
+}
+
+// purgeTrash periodically removes entries deleted longer than the configured retention. Retention
+// is read on every run, so it can be changed on reload.
+func (s *Shorty) purgeTrash() {
+	if s.settings().TrashRetention == 0 {
+		logger.Info("Trash retention is not set, deleted entries are kept forever.")
+	}
+
+	ticker := time.NewTicker(purgeInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-ticker.C:
+		}
+
+		retentionHours := s.settings().TrashRetention
+		if retentionHours == 0 {
+			continue
+		}
+		retention := time.Duration(retentionHours) * time.Hour
+		before := time.Now().Add(-retention).Unix()
+		purged, err := s.persistence.Purge(context.Background(), before)
+		if err != nil {
+			logger.WithError(err).Error("Error on purging deleted entries")
+			continue
+		}
+		if purged > 0 {
+			logger.WithFields(logrus.Fields{"count": purged, "retention": retention.String()}).
+				Info("Purged deleted entries")
+		}
+	}
+}
+
+// settings returns current configuration, including settings changed on reload.
+func (s *Shorty) settings() *Config {
+	if live, ok := s.live.Load().(*Config); ok {
+		return live
+	}
+	return s.config
+}
+
+// Reload validates the informed configuration and applies settings safe to change at runtime:
+// shutdown timeout and delay, trash retention, admin token, client identities, password attempt
+// limits and logging. Other settings require a restart, changes on those are logged and ignored.
+func (s *Shorty) Reload(config *Config) error {
+	if err := config.Validate(); err != nil {
+		return err
+	}
+
+	current := s.settings()
+	next := *current
+	next.reload(config)
+
+	ignored := *config
+	ignored.reload(current)
+	if !reflect.DeepEqual(&ignored, current) {
+		logger.Warn("Changes on settings requiring restart are ignored on reload")
+	}
+
+	if err := SetLogging(next.LogLevel, next.LogFormat); err != nil {
+		return err
+	}
+	s.live.Store(&next)
+	s.handler.attempts.setLimits(
+		next.PasswordMaxAttempts, time.Duration(next.PasswordLockout)*time.Second)
+	logger.Info("Configuration is reloaded.")
+	return nil
 }
 
-// setUpRoutes define how the routes are configured for this application.
+// SetConfigLoader enables reloading configuration on SIGHUP, using the informed loader.
+func (s *Shorty) SetConfigLoader(loader ConfigLoader) {
+	s.loader = loader
+}
+
+// reloadOnSignal reloads configuration when SIGHUP is received, until done channel is closed. On
+// error, the current settings are kept.
+func (s *Shorty) reloadOnSignal() {
+	for {
+		select {
+		case <-s.done:
+			return
+		case <-s.reloadChan:
+		}
+
+		logger.Info("Received SIGHUP, reloading configuration...")
+		config, err := s.loader()
+		if err == nil {
+			err = s.Reload(config)
+		}
+		if err != nil {
+			logger.WithError(err).Error("Error on reloading configuration, keeping current")
+		}
+	}
+}
+
+// authenticateAdmin authenticates admin requests using the current admin token.
+func (s *Shorty) authenticateAdmin(c *gin.Context) {
+	adminAuth(s.settings().AdminToken)(c)
+}
+
+// authenticateClient authenticates admin listener clients using the current client identities.
+func (s *Shorty) authenticateClient(c *gin.Context) {
+	clientCertAuth(s.settings().ClientIdentities)(c)
+}
+
+// setUpRoutes define how the routes are configured for this application. When the admin listener
+// is enabled, only redirects are kept public, while metrics, health, profiling and the management API
+// are moved to the admin listener, authenticated by client certificates when configured.
 func (s *Shorty) setUpRoutes() {
+	s.engine.Use(requestID)
+	if s.accessLog != nil {
+		s.engine.Use(s.accessLog.handler)
+	}
 	s.engine.GET("/", s.handler.Slash)
-	s.engine.GET("/shorty/", s.handler.List)
-	s.engine.POST("/shorty/:short", s.handler.Create)
+	if s.adminEngine == nil {
+		s.setUpManagementRoutes(s.engine, anonymous, s.adminOnly)
+		return
+	}
 	s.engine.GET("/shorty/:short", s.handler.Read)
-	s.engine.GET("/metrics", gin.HandlerFunc(func(c *gin.Context) {
-		s.exporter.ServeHTTP(c.Writer, c.Request)
-	}))
+	s.engine.POST("/shorty/:short/unlock", s.handler.Read)
+	s.engine.POST("/shorty/:short/continue", s.handler.Continue)
+
+	s.adminEngine.Use(requestID)
+	if s.accessLog != nil {
+		s.adminEngine.Use(s.accessLog.handler)
+	}
+	authorizer, restricted := anonymous, s.adminOnly
+	if s.clientCAs != nil {
+		s.adminEngine.Use(s.authenticateClient)
+		authorizer, restricted = authorize, authorize
+	}
+	s.adminEngine.GET("/", s.handler.Slash)
+	s.adminEngine.Any("/debug/pprof/*profile", restricted(ActionAdmin), profiling)
+	s.setUpManagementRoutes(s.adminEngine, authorizer, restricted)
+}
+
+// adminOnly authorization of restricted actions when client identities are not in place, any
+// action requires the admin token.
+func (s *Shorty) adminOnly(string) gin.HandlerFunc {
+	return s.authenticateAdmin
 }
 
-func (s *Shorty) registerExporters() {
-	view.RegisterExporter(s.exporter)
+// setUpManagementRoutes define health, metrics, link management, web UI and admin routes. Routes
+// removing data, or administering the application, are guarded by the restricted authorization.
+func (s *Shorty) setUpManagementRoutes(
+	r *gin.Engine,
+	authorize func(action string) gin.HandlerFunc,
+	restricted func(action string) gin.HandlerFunc,
+) {
+	r.GET("/healthz", s.Healthz)
+	r.GET("/readyz", s.Readyz)
+	if s.telemetry != nil {
+		r.GET("/metrics", gin.HandlerFunc(func(c *gin.Context) {
+			s.telemetry.ServeHTTP(c.Writer, c.Request)
+		}))
+	}
+	s.setUpLinkRoutes(r, authorize, restricted)
+	r.GET(uiPrefix+"*filepath", authorize(ActionRead), webUI(s.config.PublicURL))
 
-	if err := view.Register(
-		ochttp.ServerRequestCountView,
-		ochttp.ServerRequestBytesView,
-		ochttp.ServerResponseBytesView,
-		ochttp.ServerLatencyView,
-		ochttp.ServerRequestCountByMethod,
-		ochttp.ServerResponseCountByStatusCode,
-	); err != nil {
-		log.Fatalf("Error on registering metrics: '%s'", err)
+	admin := r.Group("/admin", restricted(ActionAdmin))
+	admin.POST("/backup", s.handler.Backup)
+	admin.GET("/audit", s.handler.Audit)
+}
+
+// setUpLinkRoutes define link management routes, each guarded by the authorization of its action,
+// updating, deleting and restoring links use the restricted authorization. Looking a link up shows
+// its URL regardless of password and clicks left, so it's restricted as well, alike listing the
+// trash, which also holds links removed for good reasons. URLs of protected
+// links are only listed for callers allowed to administer. Change history carries
+// the same details as the audit log, so it's restricted to administration alike.
+func (s *Shorty) setUpLinkRoutes(
+	r gin.IRoutes,
+	authorize func(action string) gin.HandlerFunc,
+	restricted func(action string) gin.HandlerFunc,
+) {
+	reveal := revealer(func() string { return s.settings().AdminToken })
+	r.GET("/shorty/", authorize(ActionRead), reveal, s.handler.List)
+	r.POST("/shorty/:short", authorize(ActionCreate), reserved(map[string]gin.HandlerFunc{
+		"_bulk": s.handler.Bulk,
+	}, s.handler.Create))
+	r.GET("/shorty/:short", authorize(ActionRead), reveal, reserved(map[string]gin.HandlerFunc{
+		"_trash": guarded(restricted(ActionRead), s.handler.Trash),
+	}, s.handler.Read))
+	r.PUT("/shorty/:short", restricted(ActionUpdate), s.handler.Update)
+	r.DELETE("/shorty/:short", restricted(ActionDelete), s.handler.Delete)
+	r.POST("/shorty/:short/restore", restricted(ActionDelete), s.handler.Restore)
+	r.POST("/shorty/:short/unlock", authorize(ActionRead), s.handler.Read)
+	r.POST("/shorty/:short/continue", authorize(ActionRead), s.handler.Continue)
+	r.GET("/shorty/:short/info", restricted(ActionRead), s.handler.Info)
+	r.GET("/shorty/:short/history", restricted(ActionAdmin), s.handler.History)
+	r.GET("/shorty/:short/qr", authorize(ActionRead), s.handler.QRCode(s.config.PublicURL))
+}
+
+// guarded runs the handler only when the informed authorization middleware does not abort the
+// request, for routes dispatched by reserved, which are not guarded by the router itself.
+func guarded(authorization, handler gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if authorization(c); !c.IsAborted() {
+			handler(c)
+		}
+	}
+}
+
+// profiling serves net/http/pprof handlers, the index page renders named profiles.
+func profiling(c *gin.Context) {
+	switch c.Param("profile") {
+	case "/cmdline":
+		pprof.Cmdline(c.Writer, c.Request)
+	case "/profile":
+		pprof.Profile(c.Writer, c.Request)
+	case "/symbol":
+		pprof.Symbol(c.Writer, c.Request)
+	case "/trace":
+		pprof.Trace(c.Writer, c.Request)
+	default:
+		pprof.Index(c.Writer, c.Request)
 	}
 }
 
-// Run creates the runtime instance, add routes and start http-server.
-func (s Shorty) Run() error {
+// reserved dispatch requests on reserved short strings to their own handlers, falling back to the
+// informed handler otherwise. The router does not allow static paths next to ":short" parameter.
+func reserved(routes map[string]gin.HandlerFunc, fallback gin.HandlerFunc) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if handler, found := routes[c.Param("short")]; found {
+			handler(c)
+			return
+		}
+		fallback(c)
+	}
+}
+
+// Run creates the runtime instance, add routes and start http-server. Blocks until interrupt or
+// termination signal, then shuts down gracefully: draining in-flight requests, stopping background
+// workers and closing the database.
+func (s *Shorty) Run() error {
+	signal.Notify(s.stopChan, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(s.stopChan)
+
 	s.setUpRoutes()
-	s.httpServer()
+	s.startWorker(s.purgeTrash)
+	if s.loader != nil {
+		signal.Notify(s.reloadChan, syscall.SIGHUP)
+		defer signal.Stop(s.reloadChan)
+		s.startWorker(s.reloadOnSignal)
+	}
+	if s.certReloader != nil {
+		s.startWorker(func() { s.certReloader.watch(s.done, certReloadInterval) })
+	}
+	err := s.httpServer()
 
-	return nil
+	s.stopWorkers()
+	s.persistence.Close()
+	if shutdownErr := s.telemetry.Shutdown(); shutdownErr != nil {
+		logger.WithError(shutdownErr).Error("Error on flushing traces")
+	}
+	if s.accessLog != nil {
+		if closeErr := s.accessLog.Close(); closeErr != nil {
+			logger.WithError(closeErr).Error("Error on closing access log")
+		}
+	}
+	return err
 }
 
-// Shutdown sends os.Kill signal in stop channel.
+// Shutdown sends os.Interrupt signal in stop channel, triggering graceful shutdown.
 func (s *Shorty) Shutdown() {
-	s.stopChan <- os.Kill
+	select {
+	case s.stopChan <- os.Interrupt:
+	default:
+		// shutdown is already signaled
+	}
+}
+
+// newEngine gin engine recovering from panics, access log is added with routes.
+func newEngine() *gin.Engine {
+	engine := gin.New()
+	engine.Use(gin.Recovery())
+	return engine
+}
+
+// NewRouter routes of a single listener, guarded as by the application, on the informed
+// persistence. Metrics and access log are left out, as to serve the API on tests of its clients.
+func NewRouter(config *Config, persistence *Persistence) http.Handler {
+	s := &Shorty{
+		config:      config,
+		engine:      newEngine(),
+		handler:     NewHandler(persistence),
+		persistence: persistence,
+	}
+	s.handler.attempts = newAttemptLimiter(
+		config.PasswordMaxAttempts, time.Duration(config.PasswordLockout)*time.Second)
+	s.setUpRoutes()
+	return s.engine
 }
 
 // NewShorty new application instance with basic components.
@@ -100,19 +480,49 @@ func NewShorty(config *Config) (*Shorty, error) {
 	var persistence *Persistence
 	var err error
 
-	s := &Shorty{config: config, engine: gin.Default(), stopChan: make(chan os.Signal, 1)}
+	s := &Shorty{
+		config:     config,
+		engine:     newEngine(),
+		stopChan:   make(chan os.Signal, 1),
+		reloadChan: make(chan os.Signal, 1),
+		done:       make(chan struct{}),
+		workers:    &sync.WaitGroup{},
+	}
 
-	if s.exporter, err = ocpromexp.NewExporter(ocpromexp.Options{
-		Registry: prometheus.DefaultGatherer.(*prometheus.Registry),
-	}); err != nil {
+	if err = SetLogging(config.LogLevel, config.LogFormat); err != nil {
+		return nil, err
+	}
+	s.accessLog = newAccessLogger(config)
+	if config.TLSCert != "" {
+		if s.certReloader, err = newCertReloader(config.TLSCert, config.TLSKey); err != nil {
+			return nil, err
+		}
+	}
+	if config.AdminAddress != "" {
+		s.adminEngine = newEngine()
+	}
+	if config.AdminClientCA != "" {
+		if s.clientCAs, err = loadCertPool(config.AdminClientCA); err != nil {
+			return nil, err
+		}
+	}
+
+	if s.telemetry, err = newTelemetry(
+		config, prometheus.DefaultRegisterer, prometheus.DefaultGatherer,
+	); err != nil {
 		return nil, err
 	}
-	s.registerExporters()
 
 	if persistence, err = NewPersistence(config); err != nil {
 		return nil, err
 	}
+	s.persistence = persistence
 	s.handler = NewHandler(persistence)
+	s.handler.attempts = newAttemptLimiter(
+		config.PasswordMaxAttempts, time.Duration(config.PasswordLockout)*time.Second)
+	if err = registerLinksGauge(persistence); err != nil {
+		return nil, err
+	}
 
 	return s, nil
 }
@@ -1,11 +1,16 @@
 package shorty
 
 import (
+	"context"
 	"fmt"
 	"net/http"
+	"os"
+	"strings"
+	"syscall"
 	"testing"
 	"time"
 
+	"github.com/gin-gonic/gin"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -23,8 +28,17 @@ func TestShortyNewShorty(t *testing.T) {
 }
 
 func TestShortyRun(t *testing.T) {
+	// slow endpoint, to assert in-flight requests are drained on shutdown
+	shorty.engine.GET("/slow", func(c *gin.Context) {
+		time.Sleep(2 * time.Second)
+		c.String(http.StatusOK, "slow")
+	})
+
 	t.Log("Running Shorty in background")
-	go shorty.Run()
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- shorty.Run()
+	}()
 
 	t.Log("Waiting a few seconds for app bootstrap...")
 	time.Sleep(5 * time.Second)
@@ -35,6 +49,181 @@ func TestShortyRun(t *testing.T) {
 	assert.Nil(t, err)
 	assert.Equal(t, http.StatusOK, res.StatusCode)
 
+	slowRes := make(chan *http.Response, 1)
+	go func() {
+		res, err := http.Get(fmt.Sprintf("http://%s/slow", config.Address))
+		assert.Nil(t, err)
+		slowRes <- res
+	}()
+	time.Sleep(500 * time.Millisecond)
+
 	t.Log("Shuting down app")
 	shorty.Shutdown()
+
+	res = <-slowRes
+	assert.NotNil(t, res)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Nil(t, <-runErr)
+}
+
+func TestShortyReserved(t *testing.T) {
+	respond := func(body string) gin.HandlerFunc {
+		return func(c *gin.Context) {
+			c.String(http.StatusOK, body)
+		}
+	}
+
+	router := gin.Default()
+	router.GET("/:short", reserved(map[string]gin.HandlerFunc{
+		"_reserved": respond("reserved"),
+	}, respond("fallback")))
+
+	for path, expected := range map[string]string{"/_reserved": "reserved", "/abc": "fallback"} {
+		req, err := http.NewRequest("GET", path, nil)
+		assert.Nil(t, err)
+
+		rr := recorderServeHTTP(router, req)
+		assert.Equal(t, expected, rr.Body.String())
+	}
+}
+
+func TestShortyAdminRoutes(t *testing.T) {
+	config := &Config{
+		ServerConfig:  ServerConfig{AdminAddress: "127.0.0.1:8090"},
+		StorageConfig: StorageConfig{DatabaseFile: "/var/tmp/shorty-test-admin.sqlite"},
+	}
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	assert.Nil(t, p.Write(context.Background(), &Shortened{Short: short, URL: longURL}))
+
+	s := &Shorty{
+		config:      config,
+		engine:      gin.New(),
+		adminEngine: gin.New(),
+		handler:     NewHandler(p),
+		persistence: p,
+	}
+	s.setUpRoutes()
+
+	tests := []struct {
+		method string
+		path   string
+		public int
+		admin  int
+	}{
+		{"GET", "/shorty/" + short, http.StatusTemporaryRedirect, http.StatusTemporaryRedirect},
+		{"GET", "/shorty/", http.StatusNotFound, http.StatusOK},
+		{"GET", "/shorty/_trash", http.StatusNoContent, http.StatusForbidden},
+		{"GET", "/shorty/" + short + "/info", http.StatusNotFound, http.StatusForbidden},
+		{"GET", "/shorty/" + short + "/qr", http.StatusNotFound, http.StatusOK},
+		{"POST", "/shorty/" + short + "/unlock", http.StatusSeeOther, http.StatusSeeOther},
+		{"POST", "/shorty/" + short + "/continue", http.StatusSeeOther, http.StatusSeeOther},
+		{"PUT", "/shorty/" + short, http.StatusNotFound, http.StatusForbidden},
+		{"DELETE", "/shorty/" + short, http.StatusNotFound, http.StatusForbidden},
+		{"POST", "/shorty/" + short + "/restore", http.StatusNotFound, http.StatusForbidden},
+		{"GET", "/healthz", http.StatusNotFound, http.StatusOK},
+		{"GET", "/ui/", http.StatusNotFound, http.StatusOK},
+		{"GET", "/debug/pprof/", http.StatusNotFound, http.StatusForbidden},
+		{"GET", "/admin/audit", http.StatusNotFound, http.StatusForbidden},
+		{"GET", "/shorty/" + short + "/history", http.StatusNotFound, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.method+tt.path, func(t *testing.T) {
+			req, err := http.NewRequest(tt.method, tt.path, nil)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.public, recorderServeHTTP(s.engine, req).Code)
+
+			req, err = http.NewRequest(tt.method, tt.path, nil)
+			assert.Nil(t, err)
+			assert.Equal(t, tt.admin, recorderServeHTTP(s.adminEngine, req).Code)
+		})
+	}
+}
+
+func TestShortyRestrictedRoutes(t *testing.T) {
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-restricted.sqlite"
+	config.AdminToken = "secret"
+	_ = os.Remove(config.DatabaseFile)
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	assert.Nil(t, p.Write(context.Background(), &Shortened{Short: short, URL: longURL}))
+
+	s := &Shorty{config: config, engine: gin.New(), handler: NewHandler(p), persistence: p}
+	s.setUpRoutes()
+
+	t.Log("Without admin listener, updating, deleting, restoring, looking links up, reading " +
+		"their history and listing the trash must require the admin token")
+	body := fmt.Sprintf(`{"url":"%s"}`, longURL)
+	for _, route := range []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"PUT", "/shorty/" + short, body},
+		{"DELETE", "/shorty/" + short, ""},
+		{"POST", "/shorty/" + short + "/restore", ""},
+		{"GET", "/shorty/" + short + "/history", ""},
+		{"GET", "/shorty/" + short + "/info", ""},
+		{"GET", "/shorty/_trash", ""},
+	} {
+		req, err := http.NewRequest(route.method, route.path, strings.NewReader(route.body))
+		assert.Nil(t, err)
+		assert.Equal(t, http.StatusUnauthorized, recorderServeHTTP(s.engine, req).Code)
+
+		req, err = http.NewRequest(route.method, route.path, strings.NewReader(route.body))
+		assert.Nil(t, err)
+		req.Header.Set("Authorization", "Bearer secret")
+		assert.Equal(t, http.StatusOK, recorderServeHTTP(s.engine, req).Code)
+	}
+}
+
+func TestShortyReload(t *testing.T) {
+	s := &Shorty{
+		config:     NewConfig(),
+		handler:    NewHandler(nil),
+		reloadChan: make(chan os.Signal, 1),
+		done:       make(chan struct{}),
+	}
+	assert.Equal(t, "", s.settings().AdminToken)
+
+	config := NewConfig()
+	config.AdminToken = "token"
+	config.TrashRetention = 24
+	config.PasswordMaxAttempts = 2
+	config.PasswordLockout = 60
+	config.Address = "127.0.0.1:9999"
+	assert.Nil(t, s.Reload(config))
+
+	t.Log("Only settings safe to change at runtime must be applied")
+	assert.Equal(t, "token", s.settings().AdminToken)
+	assert.Equal(t, 24, s.settings().TrashRetention)
+	assert.Equal(t, "127.0.0.1:8000", s.settings().Address)
+	assert.Equal(t, "", s.config.AdminToken)
+	assert.Equal(t, 2, s.handler.attempts.max)
+	assert.Equal(t, time.Minute, s.handler.attempts.lockout)
+
+	config.AdminToken = "with space"
+	assert.NotNil(t, s.Reload(config))
+	assert.Equal(t, "token", s.settings().AdminToken)
+
+	t.Log("Configuration must be loaded again on signal")
+	s.SetConfigLoader(func() (*Config, error) {
+		config := NewConfig()
+		config.AdminToken = "signaled"
+		return config, nil
+	})
+	go s.reloadOnSignal()
+	s.reloadChan <- syscall.SIGHUP
+
+	deadline := time.Now().Add(time.Second)
+	for s.settings().AdminToken != "signaled" && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	close(s.done)
+	assert.Equal(t, "signaled", s.settings().AdminToken)
 }
@@ -0,0 +1,242 @@
+package shorty
+
+import (
+	"context"
+	"database/sql/driver"
+	"fmt"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/metric/unit"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// Database client metric names, kept from OpenCensus integration.
+const (
+	sqlCallsMetric   = "go.sql.client.calls"
+	sqlLatencyMetric = "go.sql.client.latency"
+)
+
+// Database client metric attributes.
+const (
+	sqlMethodKey = attribute.Key("go_sql_method")
+	sqlStatusKey = attribute.Key("go_sql_status")
+)
+
+// sqlInstruments records spans, calls and latency of database calls.
+type sqlInstruments struct {
+	tracer  trace.Tracer
+	calls   metric.Int64Counter
+	latency metric.Float64Histogram
+}
+
+// start starts a span for the database call, the returned function ends it and records metrics.
+func (i *sqlInstruments) start(
+	ctx context.Context,
+	method string,
+	query string,
+) (context.Context, func(error)) {
+	attributes := []attribute.KeyValue{semconv.DBSystemSqlite}
+	if query != "" {
+		attributes = append(attributes, semconv.DBStatementKey.String(query))
+	}
+	ctx, span := i.tracer.Start(ctx, "sql:"+method,
+		trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(attributes...))
+	start := time.Now()
+
+	return ctx, func(err error) {
+		status := "OK"
+		if err != nil {
+			status = "ERROR"
+			span.RecordError(err)
+			span.SetStatus(codes.Error, err.Error())
+		}
+		span.End()
+
+		labels := []attribute.KeyValue{sqlMethodKey.String(method), sqlStatusKey.String(status)}
+		i.calls.Add(ctx, 1, labels...)
+		i.latency.Record(ctx, float64(time.Since(start))/float64(time.Millisecond), labels...)
+	}
+}
+
+// newSQLInstruments creates instruments using the global tracer and meter providers.
+func newSQLInstruments() *sqlInstruments {
+	meter := metric.Must(global.Meter(instrumentationName))
+	return &sqlInstruments{
+		tracer: otel.Tracer(instrumentationName),
+		calls: meter.NewInt64Counter(sqlCallsMetric,
+			metric.WithDescription("The number of database calls")),
+		latency: meter.NewFloat64Histogram(sqlLatencyMetric,
+			metric.WithDescription("The latency of database calls"),
+			metric.WithUnit(unit.Milliseconds)),
+	}
+}
+
+// contextConn connection supporting context, as required by instrumentation.
+type contextConn interface {
+	driver.Conn
+	driver.Pinger
+	driver.ExecerContext
+	driver.QueryerContext
+	driver.ConnPrepareContext
+	driver.ConnBeginTx
+}
+
+// contextStmt prepared statement supporting context, as required by instrumentation.
+type contextStmt interface {
+	driver.Stmt
+	driver.StmtExecContext
+	driver.StmtQueryContext
+}
+
+// sqlConnector opens instrumented connections, wrapping the informed driver.
+type sqlConnector struct {
+	dsn         string
+	driver      driver.Driver
+	instruments *sqlInstruments
+}
+
+// Connect opens a new instrumented connection.
+func (c *sqlConnector) Connect(ctx context.Context) (_ driver.Conn, err error) {
+	_, end := c.instruments.start(ctx, "connect", "")
+	defer func() { end(err) }()
+
+	conn, err := c.driver.Open(c.dsn)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, ok := conn.(contextConn)
+	if !ok {
+		_ = conn.Close()
+		return nil, fmt.Errorf("database driver does not support context")
+	}
+	return &sqlConn{contextConn: wrapped, instruments: c.instruments}, nil
+}
+
+// Driver returns the wrapped driver.
+func (c *sqlConnector) Driver() driver.Driver {
+	return c.driver
+}
+
+// newSQLConnector connector for the driver and data source name, instrumented with the global
+// tracer and meter providers.
+func newSQLConnector(d driver.Driver, dsn string) driver.Connector {
+	return &sqlConnector{dsn: dsn, driver: d, instruments: newSQLInstruments()}
+}
+
+// sqlConn instrumented connection.
+type sqlConn struct {
+	contextConn
+	instruments *sqlInstruments
+}
+
+// Ping checks the connection.
+func (c *sqlConn) Ping(ctx context.Context) (err error) {
+	_, end := c.instruments.start(ctx, "ping", "")
+	defer func() { end(err) }()
+	return c.contextConn.Ping(ctx)
+}
+
+// ExecContext executes the query.
+func (c *sqlConn) ExecContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (_ driver.Result, err error) {
+	ctx, end := c.instruments.start(ctx, "exec", query)
+	defer func() { end(err) }()
+	return c.contextConn.ExecContext(ctx, query, args)
+}
+
+// QueryContext executes the query.
+func (c *sqlConn) QueryContext(
+	ctx context.Context,
+	query string,
+	args []driver.NamedValue,
+) (_ driver.Rows, err error) {
+	ctx, end := c.instruments.start(ctx, "query", query)
+	defer func() { end(err) }()
+	return c.contextConn.QueryContext(ctx, query, args)
+}
+
+// PrepareContext prepares an instrumented statement.
+func (c *sqlConn) PrepareContext(ctx context.Context, query string) (_ driver.Stmt, err error) {
+	ctx, end := c.instruments.start(ctx, "prepare", query)
+	defer func() { end(err) }()
+
+	stmt, err := c.contextConn.PrepareContext(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+	wrapped, ok := stmt.(contextStmt)
+	if !ok {
+		_ = stmt.Close()
+		return nil, fmt.Errorf("database driver statement does not support context")
+	}
+	return &sqlStmt{contextStmt: wrapped, query: query, instruments: c.instruments}, nil
+}
+
+// BeginTx starts an instrumented transaction.
+func (c *sqlConn) BeginTx(ctx context.Context, opts driver.TxOptions) (_ driver.Tx, err error) {
+	_, end := c.instruments.start(ctx, "begin", "")
+	defer func() { end(err) }()
+
+	tx, err := c.contextConn.BeginTx(ctx, opts)
+	if err != nil {
+		return nil, err
+	}
+	return &sqlTx{Tx: tx, ctx: ctx, instruments: c.instruments}, nil
+}
+
+// sqlStmt instrumented prepared statement.
+type sqlStmt struct {
+	contextStmt
+	query       string
+	instruments *sqlInstruments
+}
+
+// ExecContext executes the prepared statement.
+func (s *sqlStmt) ExecContext(
+	ctx context.Context,
+	args []driver.NamedValue,
+) (_ driver.Result, err error) {
+	ctx, end := s.instruments.start(ctx, "exec", s.query)
+	defer func() { end(err) }()
+	return s.contextStmt.ExecContext(ctx, args)
+}
+
+// QueryContext executes the prepared statement query.
+func (s *sqlStmt) QueryContext(
+	ctx context.Context,
+	args []driver.NamedValue,
+) (_ driver.Rows, err error) {
+	ctx, end := s.instruments.start(ctx, "query", s.query)
+	defer func() { end(err) }()
+	return s.contextStmt.QueryContext(ctx, args)
+}
+
+// sqlTx instrumented transaction, commit and rollback spans use the context informed on begin.
+type sqlTx struct {
+	driver.Tx
+	ctx         context.Context
+	instruments *sqlInstruments
+}
+
+// Commit commits the transaction.
+func (t *sqlTx) Commit() (err error) {
+	_, end := t.instruments.start(t.ctx, "commit", "")
+	defer func() { end(err) }()
+	return t.Tx.Commit()
+}
+
+// Rollback aborts the transaction.
+func (t *sqlTx) Rollback() (err error) {
+	_, end := t.instruments.start(t.ctx, "rollback", "")
+	defer func() { end(err) }()
+	return t.Tx.Rollback()
+}
@@ -0,0 +1,252 @@
+package shorty
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/sirupsen/logrus"
+	"go.opentelemetry.io/contrib/instrumentation/net/http/otelhttp"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	otelprom "go.opentelemetry.io/otel/exporters/prometheus"
+	"go.opentelemetry.io/otel/metric/global"
+	"go.opentelemetry.io/otel/propagation"
+	export "go.opentelemetry.io/otel/sdk/export/metric"
+	"go.opentelemetry.io/otel/sdk/metric/aggregator/histogram"
+	controller "go.opentelemetry.io/otel/sdk/metric/controller/basic"
+	processor "go.opentelemetry.io/otel/sdk/metric/processor/basic"
+	selector "go.opentelemetry.io/otel/sdk/metric/selector/simple"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	// instrumentationName names the tracer and meter of this application.
+	instrumentationName = "github.com/otaviof/shorty"
+	// flushTimeout limits the time flushing pending spans on shutdown.
+	flushTimeout = 5 * time.Second
+	// storageBackend names the storage backend on spans.
+	storageBackend = "sqlite"
+)
+
+// Span attributes of link operations.
+const (
+	spanShortKey   = attribute.Key("shorty.short")
+	spanOutcomeKey = attribute.Key("shorty.outcome")
+	spanBackendKey = attribute.Key("shorty.backend")
+)
+
+// histogramBoundaries buckets for latency histograms, HTTP latency is recorded in microseconds
+// and database latency in milliseconds.
+var histogramBoundaries = []float64{
+	1, 5, 10, 25, 50, 100, 250, 500, 1000, 2500, 5000, 10000, 25000, 50000, 100000, 250000, 500000,
+	1000000, 2500000, 5000000, 10000000,
+}
+
+// unsampledPaths metrics and health endpoints are never traced, still they are measured.
+var unsampledPaths = map[string]bool{"/metrics": true, "/healthz": true, "/readyz": true}
+
+// pathSampler drops spans of requests on unsampled paths, delegating other decisions.
+type pathSampler struct {
+	sdktrace.Sampler
+}
+
+// ShouldSample drops spans having a unsampled path as HTTP target.
+func (p pathSampler) ShouldSample(params sdktrace.SamplingParameters) sdktrace.SamplingResult {
+	for _, attr := range params.Attributes {
+		if attr.Key != semconv.HTTPTargetKey {
+			continue
+		}
+		path := strings.SplitN(attr.Value.AsString(), "?", 2)[0]
+		if unsampledPaths[path] {
+			return sdktrace.SamplingResult{
+				Decision:   sdktrace.Drop,
+				Tracestate: trace.SpanContextFromContext(params.ParentContext).TraceState(),
+			}
+		}
+	}
+	return p.Sampler.ShouldSample(params)
+}
+
+// Description describes the sampler, and the delegated one.
+func (p pathSampler) Description() string {
+	return fmt.Sprintf("PathSampler{%s}", p.Sampler.Description())
+}
+
+// telemetry OpenTelemetry metrics, served in Prometheus format, and traces exported via OTLP.
+type telemetry struct {
+	exporter *otelprom.Exporter       // serves metrics on "/metrics"
+	tracer   *sdktrace.TracerProvider // exports spans, nil when OTLP endpoint is not informed
+}
+
+// ServeHTTP serves metrics in Prometheus format.
+func (t *telemetry) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	t.exporter.ServeHTTP(w, r)
+}
+
+// Shutdown flushes pending spans to the collector, up to flush timeout.
+func (t *telemetry) Shutdown() error {
+	if t.tracer == nil {
+		return nil
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), flushTimeout)
+	defer cancel()
+	return t.tracer.Shutdown(ctx)
+}
+
+// newTelemetry sets up the global meter provider, exporting metrics on the informed Prometheus
+// registry. Trace context is propagated using W3C headers, and when the OTLP endpoint is informed,
+// the global tracer provider exports sampled spans to it. Metrics do not carry resource attributes
+// as labels.
+func newTelemetry(
+	config *Config,
+	registerer prometheus.Registerer,
+	gatherer prometheus.Gatherer,
+) (*telemetry, error) {
+	ctrl := controller.New(processor.NewFactory(
+		selector.NewWithHistogramDistribution(
+			histogram.WithExplicitBoundaries(histogramBoundaries),
+		),
+		export.CumulativeExportKindSelector(),
+		processor.WithMemory(true),
+	), controller.WithResource(resource.Empty()))
+	exporter, err := otelprom.New(otelprom.Config{
+		Registerer:                 registerer,
+		Gatherer:                   gatherer,
+		DefaultHistogramBoundaries: histogramBoundaries,
+	}, ctrl)
+	if err != nil {
+		return nil, err
+	}
+	global.SetMeterProvider(exporter.MeterProvider())
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{}, propagation.Baggage{},
+	))
+
+	t := &telemetry{exporter: exporter}
+	if config.OTLPEndpoint == "" {
+		return t, nil
+	}
+
+	options := []otlptracehttp.Option{otlptracehttp.WithEndpoint(config.OTLPEndpoint)}
+	if config.OTLPInsecure {
+		options = append(options, otlptracehttp.WithInsecure())
+	}
+	spanExporter, err := otlptrace.New(context.Background(), otlptracehttp.NewClient(options...))
+	if err != nil {
+		return nil, err
+	}
+	t.tracer = sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(spanExporter),
+		sdktrace.WithResource(resource.NewWithAttributes(
+			semconv.SchemaURL, semconv.ServiceNameKey.String(config.ServiceName),
+		)),
+		sdktrace.WithSampler(pathSampler{
+			sdktrace.ParentBased(sdktrace.TraceIDRatioBased(config.TraceSampleRate)),
+		}),
+	)
+	otel.SetTracerProvider(t.tracer)
+	logger.WithFields(logrus.Fields{
+		"endpoint":    config.OTLPEndpoint,
+		"sample-rate": config.TraceSampleRate,
+	}).Info("Exporting traces via OTLP")
+	return t, nil
+}
+
+// startSpan starts a span for a link operation, child of the span in context.
+func startSpan(
+	ctx context.Context,
+	name string,
+	attributes ...attribute.KeyValue,
+) (context.Context, trace.Span) {
+	return otel.Tracer(instrumentationName).Start(ctx, name, trace.WithAttributes(attributes...))
+}
+
+// endSpan ends the span, recording the error when informed.
+func endSpan(span trace.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// annotateSpan sets short string and outcome attributes on the request span.
+func annotateSpan(ctx context.Context, short, outcome string) {
+	trace.SpanFromContext(ctx).SetAttributes(
+		spanShortKey.String(short),
+		spanOutcomeKey.String(outcome),
+	)
+}
+
+// routeTemplate template of the route matching request path, as in "/shorty/:short", empty when
+// none does.
+func routeTemplate(templates []string, path string) string {
+	segments := strings.Split(path, "/")
+	for _, template := range templates {
+		if matchRoute(strings.Split(template, "/"), segments) {
+			return template
+		}
+	}
+	return ""
+}
+
+// matchRoute checks if path segments match the route template segments, parameters match any
+// non-empty segment and catch-all parameters match the remaining segments.
+func matchRoute(template, segments []string) bool {
+	for i, part := range template {
+		if strings.HasPrefix(part, "*") {
+			return true
+		}
+		if i >= len(segments) {
+			return false
+		}
+		if strings.HasPrefix(part, ":") {
+			if segments[i] == "" {
+				return false
+			}
+			continue
+		}
+		if part != segments[i] {
+			return false
+		}
+	}
+	return len(template) == len(segments)
+}
+
+// instrumented wraps the engine with OpenTelemetry instrumentation, spans are named after request
+// method and route template, as in "GET /shorty/:short", so names don't grow with links, and
+// metrics carry the request method and response status code.
+func instrumented(engine *gin.Engine) http.Handler {
+	templates := map[string][]string{}
+	for _, route := range engine.Routes() {
+		templates[route.Method] = append(templates[route.Method], route.Path)
+	}
+	withStatus := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		metrics := httpsnoop.CaptureMetrics(engine, w, r)
+		labeler, _ := otelhttp.LabelerFromContext(r.Context())
+		labeler.Add(
+			semconv.HTTPMethodKey.String(r.Method),
+			semconv.HTTPStatusCodeKey.Int(metrics.Code),
+		)
+		if template := routeTemplate(templates[r.Method], r.URL.Path); template != "" {
+			trace.SpanFromContext(r.Context()).SetName(r.Method + " " + template)
+		}
+	})
+	return otelhttp.NewHandler(withStatus, "shorty",
+		otelhttp.WithSpanNameFormatter(func(_ string, r *http.Request) string {
+			return r.Method
+		}),
+	)
+}
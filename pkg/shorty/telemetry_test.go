@@ -0,0 +1,300 @@
+package shorty
+
+import (
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	coltracepb "go.opentelemetry.io/proto/otlp/collector/trace/v1"
+	tracepb "go.opentelemetry.io/proto/otlp/trace/v1"
+	"google.golang.org/protobuf/proto"
+)
+
+// collectorStub OTLP/HTTP collector, keeping received spans.
+type collectorStub struct {
+	mu       sync.Mutex
+	spans    []*tracepb.Span // received spans
+	services []string        // service names on received resources
+}
+
+// names of received spans.
+func (c *collectorStub) names() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	names := []string{}
+	for _, span := range c.spans {
+		names = append(names, span.Name)
+	}
+	return names
+}
+
+// span first received span with informed name, nil when not found.
+func (c *collectorStub) span(name string) *tracepb.Span {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, span := range c.spans {
+		if span.Name == name {
+			return span
+		}
+	}
+	return nil
+}
+
+// spanAttributes attributes of span as strings, by key.
+func spanAttributes(span *tracepb.Span) map[string]string {
+	attributes := map[string]string{}
+	for _, attr := range span.Attributes {
+		attributes[attr.Key] = attr.Value.GetStringValue()
+	}
+	return attributes
+}
+
+// ServeHTTP receives trace export requests.
+func (c *collectorStub) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path != "/v1/traces" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	req := &coltracepb.ExportTraceServiceRequest{}
+	if err = proto.Unmarshal(body, req); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.mu.Lock()
+	for _, resourceSpans := range req.ResourceSpans {
+		for _, attr := range resourceSpans.Resource.Attributes {
+			if attr.Key == "service.name" {
+				c.services = append(c.services, attr.Value.GetStringValue())
+			}
+		}
+		for _, librarySpans := range resourceSpans.InstrumentationLibrarySpans {
+			for _, span := range librarySpans.Spans {
+				c.spans = append(c.spans, span)
+			}
+		}
+	}
+	c.mu.Unlock()
+
+	res, _ := proto.Marshal(&coltracepb.ExportTraceServiceResponse{})
+	w.Header().Set("Content-Type", "application/x-protobuf")
+	_, _ = w.Write(res)
+}
+
+func TestTelemetryRouteTemplate(t *testing.T) {
+	templates := []string{"/shorty/", "/shorty/:short", "/shorty/:short/qr", "/debug/pprof/*profile"}
+	tests := map[string]string{
+		"/shorty/":           "/shorty/",
+		"/shorty/abc":        "/shorty/:short",
+		"/shorty/abc/qr":     "/shorty/:short/qr",
+		"/debug/pprof/heap":  "/debug/pprof/*profile",
+		"/shorty/abc/bogus":  "",
+		"/bogus":             "",
+		"/shorty/abc/qr/abc": "",
+	}
+	for path, expected := range tests {
+		assert.Equal(t, expected, routeTemplate(templates, path), path)
+	}
+}
+
+// telemetryRouter instrumented router with link routes and health endpoint.
+func telemetryRouter(p *Persistence) http.Handler {
+	h := NewHandler(p)
+	router := gin.New()
+	router.POST("/shorty/:short", h.Create)
+	router.GET("/shorty/:short", h.Read)
+	router.GET("/healthz", func(c *gin.Context) { c.Status(http.StatusOK) })
+	return instrumented(router)
+}
+
+func TestTelemetryMetrics(t *testing.T) {
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-telemetry-metrics.sqlite"
+	_ = os.Remove(config.DatabaseFile)
+
+	registry := prometheus.NewRegistry()
+	tel, err := newTelemetry(config, registry, registry)
+	assert.Nil(t, err)
+	assert.Nil(t, tel.tracer)
+
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	router := telemetryRouter(p)
+
+	body := fmt.Sprintf(`{"url":"%s"}`, longURL)
+	req := httptest.NewRequest("POST", fmt.Sprintf("/shorty/%s", short), strings.NewReader(body))
+	res := recorderServeHTTP(router, req)
+	assert.Equal(t, http.StatusCreated, res.Code)
+
+	res = recorderServeHTTP(tel, httptest.NewRequest("GET", "/metrics", nil))
+	assert.Equal(t, http.StatusOK, res.Code)
+	metrics := res.Body.String()
+
+	t.Log("HTTP metrics must carry method and status code")
+	for _, name := range []string{
+		"http_server_duration_count",
+		"http_server_request_content_length",
+		"http_server_response_content_length",
+	} {
+		assert.Contains(t, metrics, name)
+	}
+	assert.Contains(t, metrics, `http_method="POST"`)
+	assert.Contains(t, metrics, `http_status_code="201"`)
+
+	t.Log("Database metrics must carry method and status")
+	assert.Contains(t, metrics, `go_sql_client_calls{go_sql_method="exec",go_sql_status="OK"}`)
+	assert.Contains(t, metrics, "go_sql_client_latency_bucket")
+}
+
+func TestTelemetryOTLP(t *testing.T) {
+	collector := &collectorStub{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-telemetry-otlp.sqlite"
+	config.OTLPEndpoint = strings.TrimPrefix(server.URL, "http://")
+	config.OTLPInsecure = true
+	assert.Nil(t, config.Validate())
+	_ = os.Remove(config.DatabaseFile)
+
+	registry := prometheus.NewRegistry()
+	tel, err := newTelemetry(config, registry, registry)
+	assert.Nil(t, err)
+	assert.NotNil(t, tel.tracer)
+
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	router := telemetryRouter(p)
+
+	for _, path := range []string{fmt.Sprintf("/shorty/%s", short), "/healthz"} {
+		recorderServeHTTP(router, httptest.NewRequest("GET", path, nil))
+	}
+	assert.Nil(t, tel.Shutdown())
+
+	t.Log("Request and database spans must be exported, health endpoints must not")
+	names := collector.names()
+	assert.Contains(t, names, "GET /shorty/:short")
+	assert.NotContains(t, names, fmt.Sprintf("GET /shorty/%s", short))
+	assert.Contains(t, names, "sql:query")
+	assert.NotContains(t, names, "GET /healthz")
+	collector.mu.Lock()
+	assert.Contains(t, collector.services, "shorty")
+	collector.mu.Unlock()
+}
+
+func TestTelemetryPropagation(t *testing.T) {
+	collector := &collectorStub{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-telemetry-propagation.sqlite"
+	config.OTLPEndpoint = strings.TrimPrefix(server.URL, "http://")
+	config.OTLPInsecure = true
+	config.TraceSampleRate = 0
+	assert.Nil(t, config.Validate())
+	_ = os.Remove(config.DatabaseFile)
+
+	registry := prometheus.NewRegistry()
+	tel, err := newTelemetry(config, registry, registry)
+	assert.Nil(t, err)
+
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	router := telemetryRouter(p)
+
+	t.Log("Traces started here are not sampled, with sample rate zero")
+	body := fmt.Sprintf(`{"url":"%s"}`, longURL)
+	req := httptest.NewRequest("POST", fmt.Sprintf("/shorty/%s", short), strings.NewReader(body))
+	assert.Equal(t, http.StatusCreated, recorderServeHTTP(router, req).Code)
+
+	t.Log("Sampled traces informed by clients are continued")
+	traceID, parentID := "4bf92f3577b34da6a3ce929d0e0e4736", "00f067aa0ba902b7"
+	req = httptest.NewRequest("GET", fmt.Sprintf("/shorty/%s", short), nil)
+	req.Header.Set("traceparent", fmt.Sprintf("00-%s-%s-01", traceID, parentID))
+	assert.Equal(t, http.StatusTemporaryRedirect, recorderServeHTTP(router, req).Code)
+	assert.Nil(t, tel.Shutdown())
+
+	names := collector.names()
+	assert.NotContains(t, names, "shorty.validate")
+	assert.NotContains(t, names, "shorty.persistence.write")
+
+	request := collector.span("GET /shorty/:short")
+	assert.NotNil(t, request)
+	if request == nil {
+		return
+	}
+	assert.Equal(t, traceID, hex.EncodeToString(request.TraceId))
+	assert.Equal(t, parentID, hex.EncodeToString(request.ParentSpanId))
+	assert.Equal(t, short, spanAttributes(request)["shorty.short"])
+	assert.Equal(t, outcomeRedirected, spanAttributes(request)["shorty.outcome"])
+
+	read := collector.span("shorty.persistence.read")
+	assert.NotNil(t, read)
+	if read == nil {
+		return
+	}
+	assert.Equal(t, request.SpanId, read.ParentSpanId)
+	assert.Equal(t, short, spanAttributes(read)["shorty.short"])
+	assert.Equal(t, storageBackend, spanAttributes(read)["shorty.backend"])
+}
+
+func TestTelemetryCreateSpans(t *testing.T) {
+	collector := &collectorStub{}
+	server := httptest.NewServer(collector)
+	defer server.Close()
+
+	config := NewConfig()
+	config.DatabaseFile = "/var/tmp/shorty-test-telemetry-spans.sqlite"
+	config.OTLPEndpoint = strings.TrimPrefix(server.URL, "http://")
+	config.OTLPInsecure = true
+	_ = os.Remove(config.DatabaseFile)
+
+	registry := prometheus.NewRegistry()
+	tel, err := newTelemetry(config, registry, registry)
+	assert.Nil(t, err)
+
+	p, err := NewPersistence(config)
+	assert.Nil(t, err)
+	defer p.Close()
+	router := telemetryRouter(p)
+
+	req := httptest.NewRequest("POST", "/shorty/local", strings.NewReader(`{"url":"http://localhost"}`))
+	assert.Equal(t, http.StatusBadRequest, recorderServeHTTP(router, req).Code)
+	assert.Nil(t, tel.Shutdown())
+
+	t.Log("Validation span must record the rejection, and request span the outcome")
+	validate := collector.span("shorty.validate")
+	assert.NotNil(t, validate)
+	if validate == nil {
+		return
+	}
+	assert.Equal(t, tracepb.Status_STATUS_CODE_ERROR, validate.Status.Code)
+	assert.Equal(t, "local", spanAttributes(validate)["shorty.short"])
+
+	request := collector.span("POST /shorty/:short")
+	assert.NotNil(t, request)
+	if request == nil {
+		return
+	}
+	assert.Equal(t, outcomeInvalid, spanAttributes(request)["shorty.outcome"])
+	assert.NotContains(t, collector.names(), "shorty.persistence.write")
+}
@@ -0,0 +1,133 @@
+package shorty
+
+import (
+	"crypto/tls"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+)
+
+// certReloadInterval interval between checks for changes on certificate files.
+const certReloadInterval = 10 * time.Second
+
+// certReloader keeps the TLS certificate loaded from disk, reloading it when files change.
+type certReloader struct {
+	certFile string // certificate file path
+	keyFile  string // private key file path
+
+	mu      sync.RWMutex
+	cert    *tls.Certificate // current certificate
+	modTime time.Time        // most recent modification time of certificate and key files
+}
+
+// GetCertificate returns the current certificate, to be used in tls.Config.
+func (r *certReloader) GetCertificate(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return r.cert, nil
+}
+
+// latestModTime returns the most recent modification time of certificate and key files.
+func (r *certReloader) latestModTime() (time.Time, error) {
+	var latest time.Time
+	for _, path := range []string{r.certFile, r.keyFile} {
+		info, err := os.Stat(path)
+		if err != nil {
+			return latest, err
+		}
+		if info.ModTime().After(latest) {
+			latest = info.ModTime()
+		}
+	}
+	return latest, nil
+}
+
+// reload loads certificate and key when files have changed since last load, returns true when the
+// certificate is replaced. On error, the current certificate is kept.
+func (r *certReloader) reload() (bool, error) {
+	modTime, err := r.latestModTime()
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.RLock()
+	unchanged := modTime.Equal(r.modTime)
+	r.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	cert, err := tls.LoadX509KeyPair(r.certFile, r.keyFile)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.cert = &cert
+	r.modTime = modTime
+	return true, nil
+}
+
+// watch periodically reloads certificate until done channel is closed.
+func (r *certReloader) watch(done <-chan struct{}, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticker.C:
+		}
+
+		reloaded, err := r.reload()
+		if err != nil {
+			logger.WithError(err).Warn("Error on reloading TLS certificate, keeping current")
+			continue
+		}
+		if reloaded {
+			logger.WithField("file", r.certFile).Info("TLS certificate is reloaded")
+		}
+	}
+}
+
+// newCertReloader instantiate the reloader, loading the certificate for the first time.
+func newCertReloader(certFile, keyFile string) (*certReloader, error) {
+	r := &certReloader{certFile: certFile, keyFile: keyFile}
+	if _, err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// newTLSConfig TLS configuration with TLS 1.2 as minimum version, certificates are served by the
+// reloader.
+func newTLSConfig(reloader *certReloader) *tls.Config {
+	return &tls.Config{
+		MinVersion:     tls.VersionTLS12,
+		GetCertificate: reloader.GetCertificate,
+	}
+}
+
+// redirectToHTTPS handler redirecting plain HTTP requests to the HTTPS address, keeping the
+// requested host, path and query.
+func redirectToHTTPS(httpsAddress string) http.Handler {
+	_, port, _ := net.SplitHostPort(httpsAddress)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		host := r.Host
+		if hostname, _, err := net.SplitHostPort(r.Host); err == nil {
+			host = hostname
+		}
+		if port != "" && port != "443" {
+			host = net.JoinHostPort(host, port)
+		}
+
+		target := url.URL{Scheme: "https", Host: host, Path: r.URL.Path, RawQuery: r.URL.RawQuery}
+		http.Redirect(w, r, target.String(), http.StatusMovedPermanently)
+	})
+}
@@ -0,0 +1,177 @@
+package shorty
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+const (
+	tlsCertFile = "/var/tmp/shorty-test-tls.crt"
+	tlsKeyFile  = "/var/tmp/shorty-test-tls.key"
+)
+
+// writeCertificate generates a self-signed certificate for localhost, and writes certificate and
+// key as PEM files.
+func writeCertificate(t *testing.T, commonName string, certFile, keyFile string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	assert.Nil(t, err)
+
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: commonName},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	assert.Nil(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	assert.Nil(t, err)
+
+	certPEM := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+	keyPEM := pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})
+	assert.Nil(t, ioutil.WriteFile(certFile, certPEM, 0600))
+	assert.Nil(t, ioutil.WriteFile(keyFile, keyPEM, 0600))
+}
+
+// leafCommonName parses the certificate served by the reloader, returning its common name.
+func leafCommonName(t *testing.T, r *certReloader) string {
+	cert, err := r.GetCertificate(nil)
+	assert.Nil(t, err)
+	leaf, err := x509.ParseCertificate(cert.Certificate[0])
+	assert.Nil(t, err)
+	return leaf.Subject.CommonName
+}
+
+func TestTLSCertReloader(t *testing.T) {
+	writeCertificate(t, "first", tlsCertFile, tlsKeyFile)
+
+	r, err := newCertReloader(tlsCertFile, tlsKeyFile)
+	assert.Nil(t, err)
+	assert.Equal(t, "first", leafCommonName(t, r))
+
+	reloaded, err := r.reload()
+	assert.Nil(t, err)
+	assert.False(t, reloaded)
+
+	t.Log("Changed files must be reloaded")
+	writeCertificate(t, "second", tlsCertFile, tlsKeyFile)
+	future := time.Now().Add(time.Minute)
+	assert.Nil(t, os.Chtimes(tlsCertFile, future, future))
+
+	reloaded, err = r.reload()
+	assert.Nil(t, err)
+	assert.True(t, reloaded)
+	assert.Equal(t, "second", leafCommonName(t, r))
+
+	t.Log("Broken files must keep current certificate")
+	assert.Nil(t, ioutil.WriteFile(tlsKeyFile, []byte("bogus"), 0600))
+	future = future.Add(time.Minute)
+	assert.Nil(t, os.Chtimes(tlsKeyFile, future, future))
+
+	_, err = r.reload()
+	assert.Error(t, err)
+	assert.Equal(t, "second", leafCommonName(t, r))
+
+	_, err = newCertReloader(tlsCertFile, tlsKeyFile)
+	assert.Error(t, err)
+}
+
+func TestTLSRedirectToHTTPS(t *testing.T) {
+	tests := []struct {
+		httpsAddress string
+		url          string
+		location     string
+	}{
+		{"0.0.0.0:8443", "http://shorty.com:8080/shorty/abc?q=1", "https://shorty.com:8443/shorty/abc?q=1"},
+		{"0.0.0.0:443", "http://shorty.com/shorty/abc", "https://shorty.com/shorty/abc"},
+	}
+
+	for _, tt := range tests {
+		req, err := http.NewRequest("GET", tt.url, nil)
+		assert.Nil(t, err)
+
+		rr := httptest.NewRecorder()
+		redirectToHTTPS(tt.httpsAddress).ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+		assert.Equal(t, tt.location, rr.Result().Header.Get("Location"))
+	}
+}
+
+func TestTLSHTTPServer(t *testing.T) {
+	writeCertificate(t, "localhost", tlsCertFile, tlsKeyFile)
+	reloader, err := newCertReloader(tlsCertFile, tlsKeyFile)
+	assert.Nil(t, err)
+
+	config := NewConfig()
+	config.Address = "127.0.0.1:8443"
+	config.TLSCert = tlsCertFile
+	config.TLSKey = tlsKeyFile
+	config.TLSRedirectAddress = "127.0.0.1:8081"
+	assert.Nil(t, config.Validate())
+
+	s := &Shorty{
+		config:       config,
+		engine:       gin.New(),
+		stopChan:     make(chan os.Signal, 1),
+		certReloader: reloader,
+		done:         make(chan struct{}),
+		workers:      &sync.WaitGroup{},
+	}
+	s.engine.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, "tls")
+	})
+
+	serverErr := make(chan error, 1)
+	go func() {
+		serverErr <- s.httpServer()
+	}()
+	time.Sleep(time.Second)
+
+	client := &http.Client{
+		Transport: &http.Transport{TLSClientConfig: &tls.Config{
+			InsecureSkipVerify: true,
+			MaxVersion:         tls.VersionTLS11,
+		}},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+
+	t.Log("TLS versions older than 1.2 must be refused")
+	_, err = client.Get("https://127.0.0.1:8443/")
+	assert.Error(t, err)
+
+	client.Transport.(*http.Transport).TLSClientConfig.MaxVersion = 0
+	res, err := client.Get("https://127.0.0.1:8443/")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.True(t, res.TLS.Version >= tls.VersionTLS12)
+
+	res, err = client.Get("http://127.0.0.1:8081/shorty/abc")
+	assert.Nil(t, err)
+	assert.Equal(t, http.StatusMovedPermanently, res.StatusCode)
+	assert.Equal(t, "https://127.0.0.1:8443/shorty/abc", res.Header.Get("Location"))
+
+	s.Shutdown()
+	assert.Nil(t, <-serverErr)
+}
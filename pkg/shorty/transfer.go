@@ -0,0 +1,231 @@
+package shorty
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+)
+
+// Formats supported to import and export entries.
+const (
+	FormatCSV    = "csv"
+	FormatJSON   = "json"
+	FormatNDJSON = "ndjson"
+)
+
+// csvHeader columns written and expected in CSV format.
+var csvHeader = []string{
+	"short", "url", "created_at", "preview", "password_hash", "max_clicks", "clicks",
+}
+
+// transferEntry entry as transferred, carrying the password hash which is not shown on responses.
+type transferEntry struct {
+	*Shortened
+	PasswordHash string `json:"password_hash,omitempty"` // bcrypt hash of password
+}
+
+// Encoder writes entries in a given format, one at the time.
+type Encoder interface {
+	Encode(s *Shortened) error // write a single entry
+	Close() error              // finish the document, does not close the underlying writer
+}
+
+// Decoder reads entries in a given format, one at the time.
+type Decoder interface {
+	Decode(s *Shortened) error // read the next entry, returns io.EOF when there are no more entries
+}
+
+// jsonEncoder writes a JSON array, one entry per line, or new-line delimited JSON when not an array.
+type jsonEncoder struct {
+	w     io.Writer
+	array bool // write a JSON array
+	count int  // amount of entries written
+}
+
+// Encode writes entry, prefixed by array opening bracket or separator when needed.
+func (j *jsonEncoder) Encode(s *Shortened) error {
+	payload, err := json.Marshal(&transferEntry{Shortened: s, PasswordHash: s.PasswordHash})
+	if err != nil {
+		return err
+	}
+	prefix, suffix := "", "\n"
+	if j.array {
+		prefix, suffix = ",\n", ""
+		if j.count == 0 {
+			prefix = "[\n"
+		}
+	}
+	j.count++
+	_, err = fmt.Fprintf(j.w, "%s%s%s", prefix, payload, suffix)
+	return err
+}
+
+// Close writes the array closing bracket.
+func (j *jsonEncoder) Close() error {
+	if !j.array {
+		return nil
+	}
+	closing := "\n]\n"
+	if j.count == 0 {
+		closing = "[]\n"
+	}
+	_, err := io.WriteString(j.w, closing)
+	return err
+}
+
+// jsonDecoder reads entries from a JSON array, or a new-line delimited JSON stream.
+type jsonDecoder struct {
+	dec      *json.Decoder
+	array    bool // payload is a JSON array
+	begun    bool // opening bracket has been consumed
+	transfer bool // entries carry password hash, as transferred on export
+}
+
+// Decode the next entry, the JSON array opening bracket is consumed on first call.
+func (j *jsonDecoder) Decode(s *Shortened) error {
+	if !j.array {
+		return j.decodeEntry(s)
+	}
+	if !j.begun {
+		token, err := j.dec.Token()
+		if err != nil {
+			return err
+		}
+		if delim, ok := token.(json.Delim); !ok || delim != '[' {
+			return fmt.Errorf("expected JSON array, found '%v'", token)
+		}
+		j.begun = true
+	}
+	if !j.dec.More() {
+		return io.EOF
+	}
+	return j.decodeEntry(s)
+}
+
+// decodeEntry decodes the next JSON value as entry, including the password hash when transferred.
+func (j *jsonDecoder) decodeEntry(s *Shortened) error {
+	if !j.transfer {
+		return j.dec.Decode(s)
+	}
+	entry := &transferEntry{Shortened: s}
+	if err := j.dec.Decode(entry); err != nil {
+		return err
+	}
+	s.PasswordHash = entry.PasswordHash
+	s.Protected = s.PasswordHash != ""
+	return nil
+}
+
+// csvEncoder writes CSV records, starting with a header.
+type csvEncoder struct {
+	w      *csv.Writer
+	header bool // header has been written
+}
+
+// Encode writes entry as a CSV record.
+func (c *csvEncoder) Encode(s *Shortened) error {
+	if !c.header {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+		c.header = true
+	}
+	return c.w.Write([]string{
+		s.Short,
+		s.URL,
+		strconv.FormatInt(s.CreatedAt, 10),
+		strconv.FormatBool(s.Preview),
+		s.PasswordHash,
+		strconv.FormatInt(s.MaxClicks, 10),
+		strconv.FormatInt(s.Clicks, 10),
+	})
+}
+
+// Close flushes buffered records, writing the header when no entries were written.
+func (c *csvEncoder) Close() error {
+	if !c.header {
+		if err := c.w.Write(csvHeader); err != nil {
+			return err
+		}
+	}
+	c.w.Flush()
+	return c.w.Error()
+}
+
+// csvDecoder reads CSV records, skipping the header.
+type csvDecoder struct {
+	r      *csv.Reader
+	header bool // header has been read
+}
+
+// Decode reads the next CSV record, only "short" and "url" columns are required.
+func (c *csvDecoder) Decode(s *Shortened) error {
+	record, err := c.r.Read()
+	if err != nil {
+		return err
+	}
+	if !c.header {
+		c.header = true
+		if len(record) > 0 && record[0] == csvHeader[0] {
+			return c.Decode(s)
+		}
+	}
+	if len(record) < 2 {
+		return fmt.Errorf("expected at least short and url columns, found '%d'", len(record))
+	}
+
+	s.Short = record[0]
+	s.URL = record[1]
+	for column, field := range map[int]*int64{2: &s.CreatedAt, 5: &s.MaxClicks, 6: &s.Clicks} {
+		*field = 0
+		if len(record) > column && record[column] != "" {
+			if *field, err = strconv.ParseInt(record[column], 10, 64); err != nil {
+				return fmt.Errorf("invalid %s '%s': %s", csvHeader[column], record[column], err)
+			}
+		}
+	}
+	s.Preview = false
+	if len(record) > 3 && record[3] != "" {
+		if s.Preview, err = strconv.ParseBool(record[3]); err != nil {
+			return fmt.Errorf("invalid preview '%s': %s", record[3], err)
+		}
+	}
+	s.PasswordHash = ""
+	if len(record) > 4 {
+		s.PasswordHash = record[4]
+	}
+	s.Protected = s.PasswordHash != ""
+	return nil
+}
+
+// NewEncoder instantiate a encoder for the informed format.
+func NewEncoder(w io.Writer, format string) (Encoder, error) {
+	switch format {
+	case FormatCSV:
+		return &csvEncoder{w: csv.NewWriter(w)}, nil
+	case FormatJSON, FormatNDJSON:
+		return &jsonEncoder{w: w, array: format == FormatJSON}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format '%s'", format)
+	}
+}
+
+// NewDecoder instantiate a decoder for the informed format.
+func NewDecoder(r io.Reader, format string) (Decoder, error) {
+	switch format {
+	case FormatCSV:
+		reader := csv.NewReader(r)
+		reader.FieldsPerRecord = -1
+		return &csvDecoder{r: reader}, nil
+	case FormatJSON, FormatNDJSON:
+		return &jsonDecoder{
+			dec:      json.NewDecoder(r),
+			array:    format == FormatJSON,
+			transfer: true,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unsupported format '%s'", format)
+	}
+}
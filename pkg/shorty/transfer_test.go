@@ -0,0 +1,70 @@
+package shorty
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferRoundTrip(t *testing.T) {
+	entries := []*Shortened{
+		{Short: "a", URL: "http://a.com/?q=1,2", CreatedAt: 1},
+		{Short: "b", URL: "http://b.com", CreatedAt: 2, Preview: true},
+		{Short: "c", URL: "http://c.com", CreatedAt: 3, Protected: true, PasswordHash: "$2a$10$x"},
+		{Short: "d", URL: "http://d.com", CreatedAt: 4, MaxClicks: 2, Clicks: 1},
+	}
+
+	for _, format := range []string{FormatCSV, FormatJSON, FormatNDJSON} {
+		t.Run(format, func(t *testing.T) {
+			buf := &bytes.Buffer{}
+			enc, err := NewEncoder(buf, format)
+			assert.Nil(t, err)
+			for _, s := range entries {
+				assert.Nil(t, enc.Encode(s))
+			}
+			assert.Nil(t, enc.Close())
+			t.Logf("Encoded as '%s':\n%s", format, buf.String())
+
+			dec, err := NewDecoder(buf, format)
+			assert.Nil(t, err)
+			decoded := []*Shortened{}
+			for {
+				s := &Shortened{}
+				if err = dec.Decode(s); err == io.EOF {
+					break
+				}
+				assert.Nil(t, err)
+				decoded = append(decoded, s)
+			}
+			assert.Equal(t, entries, decoded)
+		})
+	}
+}
+
+func TestTransferEmptyJSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc, err := NewEncoder(buf, FormatJSON)
+	assert.Nil(t, err)
+	assert.Nil(t, enc.Close())
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestTransferCSVWithoutHeader(t *testing.T) {
+	dec, err := NewDecoder(strings.NewReader("a,http://a.com\n"), FormatCSV)
+	assert.Nil(t, err)
+
+	s := &Shortened{}
+	assert.Nil(t, dec.Decode(s))
+	assert.Equal(t, &Shortened{Short: "a", URL: "http://a.com"}, s)
+	assert.Equal(t, io.EOF, dec.Decode(s))
+}
+
+func TestTransferUnsupportedFormat(t *testing.T) {
+	_, err := NewEncoder(&bytes.Buffer{}, "xml")
+	assert.Error(t, err)
+	_, err = NewDecoder(&bytes.Buffer{}, "xml")
+	assert.Error(t, err)
+}
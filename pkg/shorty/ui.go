@@ -0,0 +1,44 @@
+package shorty
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// uiPrefix path prefix of the web UI.
+	uiPrefix = "/ui/"
+	// uiConfigPath path of the web UI settings, relative to UI prefix.
+	uiConfigPath = "/config.json"
+)
+
+// uiConfig settings informed to the web UI.
+type uiConfig struct {
+	ShortURLPrefix string `json:"short_url_prefix"` // public URL of short links, up to short string
+}
+
+// uiFiles static files of the web UI, embedded on build.
+//
+//go:embed ui
+var uiFiles embed.FS
+
+// webUI serves the single-page web UI, talking to the link management API on the same listener.
+// The UI settings carry the public URL of short links, since the UI may be served on the admin
+// listener.
+func webUI(publicURL string) gin.HandlerFunc {
+	root, err := fs.Sub(uiFiles, "ui")
+	if err != nil {
+		panic(err)
+	}
+	server := http.StripPrefix(uiPrefix, http.FileServer(http.FS(root)))
+	return func(c *gin.Context) {
+		if c.Param("filepath") == uiConfigPath {
+			c.JSON(http.StatusOK, &uiConfig{ShortURLPrefix: shortURL(publicURL, c.Request, "")})
+			return
+		}
+		server.ServeHTTP(c.Writer, c.Request)
+	}
+}
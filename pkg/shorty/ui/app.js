@@ -0,0 +1,187 @@
+'use strict';
+
+// pageSize amount of links shown per page.
+const pageSize = 20;
+
+// state of listing: search term, cursor of current page, cursors of previous pages, and the cursor
+// of next page, null when on the last page.
+const state = { query: '', after: '', previous: [], next: null };
+
+// request calls the JSON API, throwing errors carrying the message informed by the server.
+async function request(method, path, body) {
+  const options = { method, headers: { Accept: 'application/json' } };
+  if (body !== undefined) {
+    options.headers['Content-Type'] = 'application/json';
+    options.body = JSON.stringify(body);
+  }
+  const res = await fetch(path, options);
+  if (!res.ok) {
+    let msg = res.statusText;
+    try {
+      msg = (await res.json()).msg || msg;
+    } catch (e) {
+      // keeping status text, body is not JSON
+    }
+    throw new Error(msg);
+  }
+  return res;
+}
+
+// config settings informed by the server, short links are based on the configured public URL, since
+// the UI may be served on the admin listener.
+const config = { short_url_prefix: `${window.location.origin}/shorty/` };
+
+// loadConfig reads the UI settings, keeping defaults when not available.
+async function loadConfig() {
+  try {
+    Object.assign(config, await (await request('GET', 'config.json')).json());
+  } catch (e) {
+    // keeping defaults, based on the current location
+  }
+}
+
+// shortURL absolute URL of a short string.
+function shortURL(short) {
+  return `${config.short_url_prefix}${encodeURIComponent(short)}`;
+}
+
+// clicksText clicks accounted on links limited by maximum clicks, other links are not accounted.
+function clicksText(link) {
+  if (!link.max_clicks) {
+    return '-';
+  }
+  return `${link.clicks || 0} / ${link.max_clicks}`;
+}
+
+// showMessage shows the outcome of the last action.
+function showMessage(text, isError) {
+  const message = document.getElementById('message');
+  message.textContent = text;
+  message.className = isError ? 'error' : '';
+}
+
+// nextCursor extracts the cursor of the next page out of "Link" header, null when not found.
+function nextCursor(header) {
+  const match = /<([^>]+)>;\s*rel="next"/.exec(header || '');
+  if (!match) {
+    return null;
+  }
+  return new URL(match[1], window.location.origin).searchParams.get('after');
+}
+
+// copy writes the text on clipboard, marking the button while copied.
+async function copy(button, text) {
+  await navigator.clipboard.writeText(text);
+  button.textContent = 'Copied';
+  setTimeout(() => { button.textContent = 'Copy'; }, 1500);
+}
+
+// renderLinks replaces the table rows with the links of current page.
+function renderLinks(links) {
+  const tbody = document.getElementById('links');
+  const template = document.getElementById('link-row');
+  tbody.replaceChildren();
+
+  for (const link of links) {
+    const row = template.content.cloneNode(true);
+    const anchor = row.querySelector('.short');
+    anchor.href = shortURL(link.short);
+    anchor.textContent = link.short;
+    // URLs of protected links are not shown to anonymous callers
+    const url = link.url || (link.protected ? 'Protected by password' : '');
+    row.querySelector('.url').textContent = url;
+    row.querySelector('.url').title = url;
+    row.querySelector('.clicks').textContent = clicksText(link);
+    row.querySelector('.created').textContent = new Date(link.created_at * 1000).toLocaleString();
+    const button = row.querySelector('.copy');
+    button.addEventListener('click', () => copy(button, shortURL(link.short)));
+    tbody.appendChild(row);
+  }
+
+  document.getElementById('previous').disabled = state.previous.length === 0;
+  document.getElementById('next').disabled = state.next === null;
+}
+
+// loadLinks fetches the page starting after the current cursor.
+async function loadLinks() {
+  const params = new URLSearchParams({ limit: pageSize });
+  if (state.after) {
+    params.set('after', state.after);
+  }
+  if (state.query) {
+    params.set('q', state.query);
+  }
+  try {
+    const res = await request('GET', `/shorty/?${params}`);
+    state.next = nextCursor(res.headers.get('Link'));
+    renderLinks(await res.json());
+  } catch (e) {
+    showMessage(`Error listing links: ${e.message}`, true);
+  }
+}
+
+// loadStats reads link statistics out of the metrics endpoint.
+async function loadStats() {
+  let text;
+  try {
+    text = await (await request('GET', '/metrics')).text();
+  } catch (e) {
+    return;
+  }
+  const totals = {};
+  for (const line of text.split('\n')) {
+    const match = /^(shorty_[a-z_]+)(\{[^}]*\})?\s+(\S+)$/.exec(line);
+    if (!match || (match[1] === 'shorty_creates_total' && !/outcome="created"/.test(match[2]))) {
+      continue;
+    }
+    totals[match[1]] = (totals[match[1]] || 0) + Number(match[3]);
+  }
+  const show = (id, name) => {
+    document.getElementById(id).textContent = totals[name] || 0;
+  };
+  show('stats-links', 'shorty_links');
+  show('stats-redirects', 'shorty_redirects_total');
+  show('stats-misses', 'shorty_redirect_misses_total');
+  show('stats-created', 'shorty_creates_total');
+}
+
+document.getElementById('create').addEventListener('submit', async (event) => {
+  event.preventDefault();
+  const form = event.target;
+  const short = form.elements.short.value.trim();
+  try {
+    await request('POST', `/shorty/${encodeURIComponent(short)}`, {
+      url: form.elements.url.value,
+      preview: form.elements.preview.checked,
+      password: form.elements.password.value || undefined,
+      max_clicks: Number(form.elements.max_clicks.value) || undefined,
+    });
+  } catch (e) {
+    showMessage(`Error creating '${short}': ${e.message}`, true);
+    return;
+  }
+  showMessage(`Short link created: ${shortURL(short)}`, false);
+  form.reset();
+  loadLinks();
+  loadStats();
+});
+
+document.getElementById('search').addEventListener('submit', (event) => {
+  event.preventDefault();
+  Object.assign(state, { query: event.target.elements.q.value.trim(), after: '', previous: [] });
+  loadLinks();
+});
+
+document.getElementById('next').addEventListener('click', () => {
+  state.previous.push(state.after);
+  state.after = state.next;
+  loadLinks();
+});
+
+document.getElementById('previous').addEventListener('click', () => {
+  state.after = state.previous.pop();
+  loadLinks();
+});
+
+loadConfig().then(loadLinks);
+loadStats();
@@ -0,0 +1,41 @@
+package shorty
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebUI(t *testing.T) {
+	router := gin.New()
+	router.GET(uiPrefix+"*filepath", webUI("https://sho.rt/"))
+
+	tests := []struct {
+		path        string
+		status      int
+		contentType string
+		contains    string
+	}{
+		{"/ui/", http.StatusOK, "text/html", "<title>Shorty</title>"},
+		{"/ui/app.js", http.StatusOK, "javascript", "/shorty/"},
+		{"/ui/style.css", http.StatusOK, "text/css", "body"},
+		{"/ui/missing.js", http.StatusNotFound, "text/plain", "not found"},
+		{"/ui/config.json", http.StatusOK, "application/json", `"https://sho.rt/shorty/"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			rr := recorderServeHTTP(router, httptest.NewRequest("GET", tt.path, nil))
+			assert.Equal(t, tt.status, rr.Code)
+			assert.Contains(t, rr.Header().Get("Content-Type"), tt.contentType)
+			assert.Contains(t, rr.Body.String(), tt.contains)
+		})
+	}
+
+	t.Log("UI path without trailing slash must redirect to UI")
+	rr := recorderServeHTTP(router, httptest.NewRequest("GET", "/ui", nil))
+	assert.Equal(t, http.StatusMovedPermanently, rr.Code)
+	assert.Equal(t, uiPrefix, rr.Header().Get("Location"))
+}
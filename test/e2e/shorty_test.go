@@ -22,12 +22,16 @@ const (
 )
 
 var config = &shorty.Config{
-	Address:      "127.0.0.1:8001",
-	IdleTimeout:  15,
-	ReadTimeout:  15,
-	WriteTimeout: 30,
-	DatabaseFile: "/var/tmp/shorty-e2e.sqlite",
-	SQLiteFlags:  "",
+	ServerConfig: shorty.ServerConfig{
+		Address:      "127.0.0.1:8001",
+		IdleTimeout:  15,
+		ReadTimeout:  15,
+		WriteTimeout: 30,
+	},
+	StorageConfig: shorty.StorageConfig{
+		DatabaseFile: "/var/tmp/shorty-e2e.sqlite",
+		SQLiteFlags:  "",
+	},
 }
 var app *shorty.Shorty
 
@@ -36,6 +40,7 @@ func TestShorty(t *testing.T) {
 	t.Run("START", start)
 	t.Run("GET on application root", getSlash)
 	t.Run("GET on metrics endpoint", getMetrics)
+	t.Run("GET on health endpoints", getHealth)
 	t.Run("POST URL using short string as sub-path", postShort)
 	t.Run("REDIRECT after GET on short string sub-path", getShort)
 	t.Run("STOP", stop)
@@ -152,6 +157,19 @@ func getMetrics(t *testing.T) {
 
 }
 
+// getHealth liveness and readiness endpoints.
+func getHealth(t *testing.T) {
+	for _, endpoint := range []string{"healthz", "readyz"} {
+		req, err := http.NewRequest("GET", fmt.Sprintf("%s/%s", testURL(), endpoint), nil)
+		assert.Nil(t, err)
+
+		res := roundTrip(t, req)
+
+		assert.Equal(t, http.StatusOK, res.StatusCode)
+		assert.Contains(t, string(readBody(t, res.Body)), "\"status\":\"ok\"")
+	}
+}
+
 // postShort drives the tests for the post actions.
 func postShort(t *testing.T) {
 	postURL := fmt.Sprintf("%s/shorty/%s", testURL(), shortURL)